@@ -18,83 +18,390 @@
 
 package common
 
-import ()
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+)
+
+type Manifest struct {
+	Icon      string   `json:"icon"`
+	Main      string   `json:"main"`
+	Scripts   []string `json:"scripts"`
+	Resources []string `json:"resources"`
+}
+
+type Author struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
 
 type Axe_v1 struct { // deprecated
-	Name            string `json:"name"`
-	Author          string `json:"author"`
-	BundleVersion   string `json:"bundleVersion"`
-	Description     string `json:"description"`
-	Email           string `json:"email"`
-	Platform        string `json:"platform"`
-	PluginName      string `json:"pluginName"`
-	Revision        string `json:"revision,omitempty"`
-	Timestamp       string `json:"timestamp"`
-	TomahawkVersion string `json:"tomahawkVersion"`
-	Type            string `json:"type"`
-	Version         string `json:"version"`
-	Website         string `json:"website"`
-	Manifest        struct {
-		Icon      string   `json:"icon"`
-		Main      string   `json:"main"`
-		Scripts   []string `json:"scripts"`
-		Resources []string `json:"resources"`
-	} `json:"manifest"`
+	Name            string   `json:"name"`
+	Author          string   `json:"author"`
+	BundleVersion   string   `json:"bundleVersion"`
+	Description     string   `json:"description"`
+	Email           string   `json:"email"`
+	Platform        string   `json:"platform"`
+	PluginName      string   `json:"pluginName"`
+	Revision        string   `json:"revision,omitempty"`
+	Timestamp       string   `json:"timestamp"`
+	TomahawkVersion string   `json:"tomahawkVersion"`
+	Type            string   `json:"type"`
+	Version         string   `json:"version"`
+	Website         string   `json:"website"`
+	Manifest        Manifest `json:"manifest"`
+}
+
+// Binary is a native library of a binary resolver, for one platform.
+type Binary struct {
+	Platform string `json:"platform"`         //e.g. linux-x86_64, win32
+	Path     string `json:"path"`             //relative to the content directory
+	Sha256   string `json:"sha256,omitempty"` //filled in by makeaxe
 }
 
 type Axe_v2 struct {
-	PluginName string `json:"pluginName"`
-	Name       string `json:"name"`
-	Author     string `json:"author,omitempty"` //deprecated
-	Email      string `json:"email,omitempty"`  //deprecated
-	Authors    []struct {
-		Name  string `json:"name"`
-		Email string `json:"email"`
-	} `json:"authors"`
-	License           string    `json:"license"` //Allowed values: GPL3, BSD, MIT, X11, ...
+	PluginName        string    `json:"pluginName"`
+	Name              string    `json:"name"`
+	Author            string    `json:"author,omitempty"` //deprecated
+	Email             string    `json:"email,omitempty"`  //deprecated
+	Authors           []Author  `json:"authors"`
+	License           string    `json:"license"` //Allowed values: see Licenses
 	CustomLicenseText string    `json:"customLicenseText,omitempty" bson:",omitempty"`
 	BundleVersion     string    `json:"bundleVersion"`
 	Description       string    `json:"description"`
-	Platform          string    `json:"platform"`
+	Platform          string    `json:"platform"`                              //any, or a single platform, see Platforms
+	Platforms         []string  `json:"platforms,omitempty" bson:",omitempty"` //e.g. linux, osx-x86_64; replaces platform if set
 	Revision          string    `json:"revision,omitempty" bson:",omitempty"`
 	Timestamp         *int64    `json:"timestamp,omitempty"` //nullable
-	ApiVersion        string    `json:"apiVersion"`
+	ApiVersion        string    `json:"apiVersion"`          //minimum resolver API version, or a constraint e.g. ">=0.7 <0.9"
 	Version           string    `json:"version"`
 	Website           string    `json:"website"`
-	Type              string    `json:"type"` //Allowed values: resolver/javascript, resolver/binary
-	Manifest          *struct { //ptr to make it nullable
-		Icon      string   `json:"icon"`
-		Main      string   `json:"main"`
-		Scripts   []string `json:"scripts"`
-		Resources []string `json:"resources"`
-	} `json:"manifest,omitempty"`
-	Features        []string `json:"features,omitempty" bson:",omitempty"`        //only if type == resolver/javascript
-	BinarySignature string   `json:"binarySignature,omitempty" bson:",omitempty"` //only if type == resolver/binary
+	Type              string    `json:"type"`                                        //Allowed values: resolver/javascript, resolver/binary
+	Manifest          *Manifest `json:"manifest,omitempty"`                          //ptr to make it nullable
+	Channel           string    `json:"channel,omitempty" bson:",omitempty"`         //Allowed values: stable (default), beta, nightly
+	Features          []string  `json:"features,omitempty" bson:",omitempty"`        //only if type == resolver/javascript
+	BinarySignature   string    `json:"binarySignature,omitempty" bson:",omitempty"` //only if type == resolver/binary
+	Binaries          []Binary  `json:"binaries,omitempty" bson:",omitempty"`        //only if type == resolver/binary
 
 	// Only used on Relaxe, do *not* set in source metadata.json
 	AxeId     string `json:"axeId,omitempty"`
 	Downloads *int64 `json:"downloads,omitempty"`
+	Publisher string `json:"publisher,omitempty" bson:",omitempty"`
+	Signature string `json:"signature,omitempty" bson:",omitempty"` //base64 ed25519 signature of the axe file
+	Sha256    string `json:"sha256,omitempty" bson:",omitempty"`    //hex SHA-256 digest of the axe file
+	Yanked    bool   `json:"yanked,omitempty" bson:",omitempty"`    //pulled by an admin, only served if asked for by version
+
+	OSes []string `json:"-" bson:"oses,omitempty"` //OSList, indexed by the MongoDB catalog
 }
 
-func Axe_v2check(axe *Axe_v2) bool {
-	if axe.PluginName == "" ||
-		axe.Name == "" ||
-		axe.Version == "" ||
-		axe.Description == "" ||
-		axe.Type == "" {
+// IsAxe_v1 returns whether the raw contents of a metadata file are in the
+// deprecated v1 format, i.e. they have a tomahawkVersion but no apiVersion.
+func IsAxe_v1(metadataBytes []byte) bool {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(metadataBytes, &fields); err != nil {
 		return false
 	}
+	_, hasTomahawkVersion := fields["tomahawkVersion"]
+	_, hasApiVersion := fields["apiVersion"]
+	return hasTomahawkVersion && !hasApiVersion
+}
 
-	if axe.Type != "resolver/javascript" &&
-		axe.Type != "resolver/binary" {
-		return false
+// Axe_v1toV2 converts deprecated v1 metadata. The packaging timestamp is
+// dropped, since it is set again whenever the axe is built.
+func Axe_v1toV2(v1 *Axe_v1) *Axe_v2 {
+	v2 := new(Axe_v2)
+	v2.PluginName = v1.PluginName
+	v2.Name = v1.Name
+	if v1.Author != "" || v1.Email != "" {
+		v2.Authors = []Author{{v1.Author, v1.Email}}
 	}
+	v2.Description = v1.Description
+	v2.Platform = v1.Platform
+	v2.Revision = v1.Revision
+	v2.ApiVersion = v1.TomahawkVersion
+	v2.Version = v1.Version
+	v2.Website = v1.Website
+	v2.Type = v1.Type
+	manifest := v1.Manifest
+	v2.Manifest = &manifest
+	return v2
+}
 
-	if axe.Type == "resolver/javascript" &&
-		(axe.Manifest.Main == "" ||
-			axe.Manifest.Icon == "") {
-		return false
+// PlatformList returns the platforms the axe declares, any if none.
+func (this *Axe_v2) PlatformList() []string {
+	if len(this.Platforms) != 0 {
+		return this.Platforms
+	}
+	if IsAnyPlatform(this.Platform) {
+		return []string{"any"}
+	}
+	return []string{this.Platform}
+}
+
+// OSList returns the operating systems of the platforms the axe declares, with
+// aliases resolved and without architectures, or just any. Catalogs use it to
+// find the axes for a platform without checking every one of them.
+func (this *Axe_v2) OSList() []string {
+	oses := []string{}
+	for _, declared := range this.PlatformList() {
+		if IsAnyPlatform(declared) {
+			return []string{"any"}
+		}
+		osName := ParsePlatform(declared).OS
+		if !contains(oses, osName) {
+			oses = append(oses, osName)
+		}
+	}
+	return oses
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+// SupportsPlatform returns whether the axe can run on the client platform,
+// see PlatformMatches.
+func (this *Axe_v2) SupportsPlatform(platform string) bool {
+	for _, declared := range this.PlatformList() {
+		if PlatformMatches(declared, platform) {
+			return true
+		}
+	}
+	return false
+}
+
+// BinaryFor returns the native library for the given platform, or nil if the
+// axe has none. An exact match wins over one through aliases or architectures,
+// and one for the client's architecture wins over one for any architecture.
+// For a client that doesn't say its architecture, libraries for several
+// architectures are ambiguous, and BinaryFor returns nil rather than guess.
+func (this *Axe_v2) BinaryFor(platform string) *Binary {
+	for i := range this.Binaries {
+		if this.Binaries[i].Platform == platform {
+			return &this.Binaries[i]
+		}
+	}
+	var anyArch *Binary
+	archs := []*Binary{}
+	for i := range this.Binaries {
+		if !PlatformMatches(this.Binaries[i].Platform, platform) {
+			continue
+		}
+		if ParsePlatform(this.Binaries[i].Platform).Arch == "" {
+			if anyArch == nil {
+				anyArch = &this.Binaries[i]
+			}
+		} else {
+			archs = append(archs, &this.Binaries[i])
+		}
+	}
+	switch {
+	case len(archs) != 0 && ParsePlatform(platform).Arch != "": //all of the client's architecture
+		return archs[0]
+	case anyArch != nil:
+		return anyArch
+	case len(archs) == 1:
+		return archs[0]
+	}
+	return nil
+}
+
+// BinarySigningData returns the data that binarySignature signs: one line with
+// the platform and SHA-256 digest of each native library, in manifest order.
+func BinarySigningData(axe *Axe_v2) []byte {
+	data := ""
+	for _, b := range axe.Binaries {
+		data += b.Platform + " " + b.Sha256 + "\n"
+	}
+	return []byte(data)
+}
+
+// Release channels, from the most to the least stable.
+var Channels = []string{"stable", "beta", "nightly"}
+
+// ChannelRank returns the position of channel in Channels, or -1 if it is not a
+// known channel. An empty channel means stable.
+func ChannelRank(channel string) int {
+	if channel == "" {
+		return 0
+	}
+	for i, c := range Channels {
+		if c == channel {
+			return i
+		}
+	}
+	return -1
+}
+
+// Allowed values of the license field. Custom requires customLicenseText.
+var Licenses = []string{"GPL2", "GPL3", "LGPL2.1", "LGPL3", "AGPL3", "BSD", "MIT", "X11", "Apache2", "MPL2", "Custom"}
+
+// MetadataProblem is a single problem found in axe metadata.
+type MetadataProblem struct {
+	Field   string `json:"field"` //JSON path of the field, e.g. manifest.main
+	Message string `json:"message"`
+}
+
+func (this MetadataProblem) String() string {
+	return this.Field + ": " + this.Message
+}
+
+type MetadataProblems []MetadataProblem
+
+// Without returns the problems that aren't about the given field.
+func (this MetadataProblems) Without(field string) MetadataProblems {
+	var result MetadataProblems
+	for _, p := range this {
+		if p.Field != field {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+func (this MetadataProblems) Strings() []string {
+	result := []string{}
+	for _, p := range this {
+		result = append(result, p.String())
 	}
+	return result
+}
+
+// MetadataError is returned when a metadata file fails Axe_v2check.
+type MetadataError struct {
+	Path     string
+	Problems MetadataProblems
+}
 
+func (this *MetadataError) Error() string {
+	return fmt.Sprintf("Bad or incomplete metadata in file %v:\n    * %v",
+		this.Path, strings.Join(this.Problems.Strings(), "\n    * "))
+}
+
+func validPluginName(pluginName string) bool {
+	if strings.Contains(pluginName, "..") {
+		return false
+	}
+	for _, r := range pluginName {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' ||
+			r == '.' || r == '_' || r == '-') {
+			return false
+		}
+	}
 	return true
 }
+
+// Axe_v2check validates axe metadata and returns every problem found, or nil
+// if there are none.
+func Axe_v2check(axe *Axe_v2) MetadataProblems {
+	var problems MetadataProblems
+	problem := func(field string, format string, args ...interface{}) {
+		problems = append(problems, MetadataProblem{field, fmt.Sprintf(format, args...)})
+	}
+
+	required := []struct {
+		field string
+		value string
+	}{
+		{"pluginName", axe.PluginName},
+		{"name", axe.Name},
+		{"version", axe.Version},
+		{"description", axe.Description},
+		{"type", axe.Type},
+	}
+	for _, r := range required {
+		if r.value == "" {
+			problem(r.field, "required field is missing or empty")
+		}
+	}
+
+	// pluginName is part of file names on Relaxe, so it must not reach outside
+	// the cache directory
+	if axe.PluginName != "" && !validPluginName(axe.PluginName) {
+		problem("pluginName", "may only contain letters, digits, '.', '_' and '-', and no '..', not %v", axe.PluginName)
+	}
+
+	if axe.Type != "" &&
+		axe.Type != "resolver/javascript" &&
+		axe.Type != "resolver/binary" {
+		problem("type", "must be resolver/javascript or resolver/binary, not %v", axe.Type)
+	}
+
+	if axe.License != "" {
+		allowed := false
+		for _, l := range Licenses {
+			allowed = allowed || axe.License == l
+		}
+		if !allowed {
+			problem("license", "%v is not one of %v", axe.License, strings.Join(Licenses, ", "))
+		} else if axe.License == "Custom" && axe.CustomLicenseText == "" {
+			problem("customLicenseText", "required if license is Custom")
+		}
+	}
+
+	if len(axe.Platforms) != 0 && !IsAnyPlatform(axe.Platform) {
+		problem("platforms", "cannot be used together with platform %v", axe.Platform)
+	}
+	for i, p := range axe.Platforms {
+		if strings.TrimSpace(p) == "" {
+			problem(fmt.Sprintf("platforms[%v]", i), "must not be empty")
+		}
+	}
+
+	if ChannelRank(axe.Channel) < 0 {
+		problem("channel", "must be one of %v, not %v", strings.Join(Channels, ", "), axe.Channel)
+	}
+
+	if axe.Type == "resolver/javascript" {
+		if axe.Manifest == nil {
+			problem("manifest", "required for resolver/javascript")
+		} else {
+			if axe.Manifest.Main == "" {
+				problem("manifest.main", "required field is missing or empty")
+			}
+			if axe.Manifest.Icon == "" {
+				problem("manifest.icon", "required field is missing or empty")
+			}
+		}
+	}
+
+	if axe.Type == "resolver/javascript" && len(axe.Binaries) != 0 {
+		problem("binaries", "only allowed for resolver/binary")
+	}
+
+	if axe.Type == "resolver/binary" {
+		if len(axe.Features) != 0 {
+			problem("features", "only allowed for resolver/javascript")
+		}
+		if axe.BinarySignature == "" {
+			problem("binarySignature", "required for resolver/binary")
+		}
+		if len(axe.Binaries) == 0 {
+			problem("binaries", "required for resolver/binary")
+		}
+		platforms := map[string]bool{}
+		for i, b := range axe.Binaries {
+			if b.Platform == "" {
+				problem(fmt.Sprintf("binaries[%v].platform", i), "required field is missing or empty")
+			} else if platforms[b.Platform] {
+				problem(fmt.Sprintf("binaries[%v].platform", i), "duplicate platform %v", b.Platform)
+			}
+			platforms[b.Platform] = true
+			if b.Path == "" {
+				problem(fmt.Sprintf("binaries[%v].path", i), "required field is missing or empty")
+			} else if clean := path.Clean(b.Path); path.IsAbs(clean) || clean == "." ||
+				clean == ".." || strings.HasPrefix(clean, "../") {
+				problem(fmt.Sprintf("binaries[%v].path", i), "must be a file in the content directory, not %v", b.Path)
+			}
+		}
+	}
+
+	return problems
+}
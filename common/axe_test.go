@@ -0,0 +1,123 @@
+/* === This file is part of Relaxe - <https://github.com/teo/relaxe> ===
+ *
+ *   Copyright 2013, Teo Mrnjavac <teo@kde.org>
+ *
+ *   Relaxe is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   Relaxe is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with Relaxe. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package common
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestIsAxe_v1(t *testing.T) {
+	tests := []struct {
+		metadata string
+		want     bool
+	}{
+		{`{"pluginName": "foo", "tomahawkVersion": "0.7"}`, true},
+		{`{"pluginName": "foo", "apiVersion": "0.7"}`, false},
+		{`{"pluginName": "foo", "tomahawkVersion": "0.7", "apiVersion": "0.7"}`, false},
+		{`{"pluginName": "foo"}`, false},
+		{`not json`, false},
+	}
+	for _, test := range tests {
+		if got := IsAxe_v1([]byte(test.metadata)); got != test.want {
+			t.Errorf("IsAxe_v1(%v) = %v, want %v", test.metadata, got, test.want)
+		}
+	}
+}
+
+func TestAxe_v1toV2(t *testing.T) {
+	tests := []struct {
+		name string
+		v1   string
+		want Axe_v2
+	}{
+		{
+			"full",
+			`{"name": "Foo", "pluginName": "foo", "author": "Jane", "email": "jane@example.org",
+			  "description": "Finds foo.", "platform": "any", "revision": "abc123", "timestamp": "1380000000",
+			  "tomahawkVersion": "0.7", "type": "resolver/javascript", "version": "1.2", "website": "http://example.org",
+			  "manifest": {"main": "foo.js", "icon": "foo.png", "scripts": ["lib.js"], "resources": []}}`,
+			Axe_v2{
+				PluginName:  "foo",
+				Name:        "Foo",
+				Authors:     []Author{{"Jane", "jane@example.org"}},
+				Description: "Finds foo.",
+				Platform:    "any",
+				Revision:    "abc123",
+				ApiVersion:  "0.7",
+				Version:     "1.2",
+				Website:     "http://example.org",
+				Type:        "resolver/javascript",
+				Manifest:    &Manifest{Main: "foo.js", Icon: "foo.png", Scripts: []string{"lib.js"}, Resources: []string{}},
+			},
+		},
+		{
+			"no author",
+			`{"pluginName": "foo", "tomahawkVersion": "0.6", "manifest": {"main": "foo.js"}}`,
+			Axe_v2{PluginName: "foo", ApiVersion: "0.6", Manifest: &Manifest{Main: "foo.js"}},
+		},
+	}
+	for _, test := range tests {
+		v1 := new(Axe_v1)
+		if err := json.Unmarshal([]byte(test.v1), v1); err != nil {
+			t.Fatalf("%v: %v", test.name, err)
+		}
+		if got := Axe_v1toV2(v1); !reflect.DeepEqual(*got, test.want) {
+			t.Errorf("%v: Axe_v1toV2() = %+v, want %+v", test.name, *got, test.want)
+		}
+	}
+}
+
+func TestAxe_v2checkBinaryPaths(t *testing.T) {
+	tests := []struct {
+		path string
+		ok   bool
+	}{
+		{"linux/libfoo.so", true},
+		{"./libfoo.so", true},
+		{"lib/../libfoo.so", true},
+		{"", false},
+		{".", false},
+		{"..", false},
+		{"../../x.so", false},
+		{"lib/../../x.so", false},
+		{"/usr/lib/x.so", false},
+	}
+	for _, test := range tests {
+		axe := &Axe_v2{
+			PluginName:      "foo",
+			Name:            "Foo",
+			Version:         "1.0.0",
+			Description:     "Finds foo.",
+			Type:            "resolver/binary",
+			BinarySignature: "sig",
+			Binaries:        []Binary{{Platform: "linux", Path: test.path}},
+		}
+		problems := Axe_v2check(axe)
+		if ok := len(problems) == 0; ok != test.ok {
+			t.Errorf("binary path %q: problems %v, want ok %v", test.path, problems.Strings(), test.ok)
+		}
+		for _, p := range problems {
+			if p.Field != "binaries[0].path" {
+				t.Errorf("binary path %q: unexpected problem %v", test.path, p)
+			}
+		}
+	}
+}
@@ -0,0 +1,119 @@
+/* === This file is part of Relaxe - <https://github.com/teo/relaxe> ===
+ *
+ *   Copyright 2013, Teo Mrnjavac <teo@kde.org>
+ *
+ *   Relaxe is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   Relaxe is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with Relaxe. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cache
+
+import (
+	"crypto/md5"
+	"fmt"
+	"github.com/teo/relaxe/common"
+	"github.com/teo/relaxe/common/util"
+	"io/ioutil"
+	"os"
+	"path"
+)
+
+// AxeFileName returns the name of the file a published axe is stored as in the
+// Relaxe cache directory.
+func AxeFileName(axe *common.Axe_v2) string {
+	return axe.PluginName + "-" + axe.AxeId + ".axe"
+}
+
+// SumFileName returns the name of the MD5 sidecar of a published axe.
+func SumFileName(axe *common.Axe_v2) string {
+	return axe.PluginName + "-" + axe.AxeId + ".md5"
+}
+
+// SigFileName returns the name of the signature sidecar makeaxe writes next to
+// a signed axe.
+func SigFileName(axe *common.Axe_v2) string {
+	return axe.PluginName + "-" + axe.AxeId + ".sig"
+}
+
+// cachePath returns the path of a file in the cache directory, or an error if
+// the file name would take it anywhere else, e.g. through a bad pluginName.
+func cachePath(cacheDir string, fileName string) (string, error) {
+	filePath := path.Join(cacheDir, fileName)
+	if path.Dir(filePath) != path.Clean(cacheDir) {
+		return "", fmt.Errorf("Bad axe file name %v.", fileName)
+	}
+	return filePath, nil
+}
+
+// Store writes the contents of a published axe and its MD5 sidecar to the
+// cache directory. The AxeId must already be set.
+func Store(cacheDir string, axe *common.Axe_v2, data []byte) (string, error) {
+	if axe.AxeId == "" {
+		return "", fmt.Errorf("Cannot store axe %v-%v without an AxeId.", axe.PluginName, axe.Version)
+	}
+
+	axeFileName := AxeFileName(axe)
+	axeFilePath, err := cachePath(cacheDir, axeFileName)
+	if err != nil {
+		return "", err
+	}
+	sumFilePath, err := cachePath(cacheDir, SumFileName(axe))
+	if err != nil {
+		return "", err
+	}
+	if ex, err := util.ExistsFile(axeFilePath); ex || err != nil {
+		return "", fmt.Errorf("Axe file %v already exists.", axeFileName)
+	}
+
+	if err := ioutil.WriteFile(axeFilePath, data, 0644); err != nil {
+		os.Remove(axeFilePath)
+		return "", err
+	}
+
+	sumValue := fmt.Sprintf("%x", md5.Sum(data)) + "\t" + axeFileName
+	if err := ioutil.WriteFile(sumFilePath, []byte(sumValue), 0644); err != nil {
+		os.Remove(axeFilePath)
+		return "", err
+	}
+
+	return axeFilePath, nil
+}
+
+// Remove deletes a published axe and its sidecars from the cache directory.
+func Remove(cacheDir string, axe *common.Axe_v2) error {
+	var firstErr error
+	for _, fileName := range []string{AxeFileName(axe), SumFileName(axe), SigFileName(axe)} {
+		filePath, err := cachePath(cacheDir, fileName)
+		if err == nil {
+			err = os.Remove(filePath)
+		}
+		if err != nil && !os.IsNotExist(err) && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// EnsureIndex writes a placeholder index.html in the cache directory if there
+// isn't one already.
+func EnsureIndex(cacheDir string) error {
+	indexPath := path.Join(cacheDir, "index.html")
+	ex, err := util.ExistsFile(indexPath)
+	if ex || err != nil {
+		return err
+	}
+
+	indexText := fmt.Sprintf("<html><head><title>Relaxe server</title></head>" +
+		"<body>Relaxe cache directory. Move along, nothing to see here.</body></html>")
+	return ioutil.WriteFile(indexPath, []byte(indexText), 0644)
+}
@@ -0,0 +1,123 @@
+/* === This file is part of Relaxe - <https://github.com/teo/relaxe> ===
+ *
+ *   Copyright 2013, Teo Mrnjavac <teo@kde.org>
+ *
+ *   Relaxe is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   Relaxe is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with Relaxe. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cache
+
+import (
+	"github.com/teo/relaxe/common"
+	"github.com/teo/relaxe/common/util"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// Files younger than this are never orphans, they may belong to a publish that
+// hasn't reached the catalog yet.
+const orphanGracePeriod = time.Hour
+
+// ScrubProblem is a catalog entry whose files in the cache directory are
+// missing or corrupt.
+type ScrubProblem struct {
+	PluginName string `json:"pluginName"`
+	Version    string `json:"version"`
+	AxeId      string `json:"axeId"`
+	Problem    string `json:"problem"`
+}
+
+type ScrubReport struct {
+	Checked  int            `json:"checked"`
+	Problems []ScrubProblem `json:"problems"`
+	Orphans  []string       `json:"orphans"` //file names
+	Deleted  []string       `json:"deleted"` //orphans removed, if asked to
+}
+
+// checkAxe returns what is wrong with the files of a published axe, or "".
+func checkAxe(cacheDir string, axe *common.Axe_v2) string {
+	axeFilePath := path.Join(cacheDir, AxeFileName(axe))
+	if ex, err := util.ExistsFile(axeFilePath); !ex || err != nil {
+		return "Axe file is missing."
+	}
+
+	if axe.Sha256 != "" {
+		sum, err := util.Sha256sum(axeFilePath)
+		if err != nil {
+			return "Cannot read axe file. " + err.Error()
+		}
+		if sum != axe.Sha256 {
+			return "Axe file does not match its SHA-256 digest."
+		}
+	}
+
+	sumBytes, err := ioutil.ReadFile(path.Join(cacheDir, SumFileName(axe)))
+	if err != nil {
+		return "MD5 file is missing."
+	}
+	expected := strings.Fields(string(sumBytes))
+	sum, err := util.Md5sum(axeFilePath)
+	if err != nil {
+		return "Cannot read axe file. " + err.Error()
+	}
+	if len(expected) == 0 || expected[0] != sum {
+		return "Axe file does not match its MD5 file."
+	}
+	return ""
+}
+
+// Scrub checks that every axe in the catalog has its files in the cache
+// directory and that they match their checksums. It also finds the axe files
+// that don't belong to any catalog entry, and deletes them if deleteOrphans.
+func Scrub(cacheDir string, axes []common.Axe_v2, deleteOrphans bool) (*ScrubReport, error) {
+	report := &ScrubReport{Problems: []ScrubProblem{}, Orphans: []string{}, Deleted: []string{}}
+
+	known := map[string]bool{}
+	for i := range axes {
+		axe := &axes[i]
+		for _, fileName := range []string{AxeFileName(axe), SumFileName(axe), SigFileName(axe)} {
+			known[fileName] = true
+		}
+
+		report.Checked++
+		if problem := checkAxe(cacheDir, axe); problem != "" {
+			report.Problems = append(report.Problems, ScrubProblem{axe.PluginName, axe.Version, axe.AxeId, problem})
+		}
+	}
+
+	entries, err := ioutil.ReadDir(cacheDir)
+	if err != nil {
+		return report, err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || known[name] || time.Since(entry.ModTime()) < orphanGracePeriod {
+			continue
+		}
+		if ext := path.Ext(name); ext != ".axe" && ext != ".md5" && ext != ".sig" {
+			continue
+		}
+		report.Orphans = append(report.Orphans, name)
+		if deleteOrphans {
+			if err := os.Remove(path.Join(cacheDir, name)); err != nil {
+				return report, err
+			}
+			report.Deleted = append(report.Deleted, name)
+		}
+	}
+	return report, nil
+}
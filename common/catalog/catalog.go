@@ -0,0 +1,100 @@
+/* === This file is part of Relaxe - <https://github.com/teo/relaxe> ===
+ *
+ *   Copyright 2013, Teo Mrnjavac <teo@kde.org>
+ *
+ *   Relaxe is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   Relaxe is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with Relaxe. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package catalog
+
+import (
+	"errors"
+	"fmt"
+	"github.com/teo/relaxe/common"
+	"time"
+)
+
+// Revision identifies a state of the catalog. It changes whenever an axe is
+// published, moved to another channel, yanked or deleted.
+type Revision struct {
+	Id       string
+	Modified time.Time //zero if unknown
+}
+
+// Catalog is the storage backend for published axe metadata, shared by
+// Relaxe and makeaxe.
+type Catalog interface {
+	// FindAll returns all the axes in the catalog.
+	FindAll() ([]common.Axe_v2, error)
+	// FindByPlatform returns the axes for any platform or for the operating
+	// system of the given one. Architectures are matched by the caller, see
+	// Axe_v2.SupportsPlatform.
+	FindByPlatform(platform string) ([]common.Axe_v2, error)
+	// FindByPluginName returns all the axes with the given pluginName. Platforms
+	// are matched by the caller, see Axe_v2.SupportsPlatform.
+	FindByPluginName(pluginName string) ([]common.Axe_v2, error)
+	// Insert adds a new axe to the catalog, or returns ErrDuplicate if there
+	// already is one with the same pluginName and version.
+	Insert(axe *common.Axe_v2) error
+	// CountByNameVersion returns the number of axes with the given pluginName and version.
+	CountByNameVersion(pluginName string, version string) (int, error)
+	// SetChannel moves the axe with the given pluginName and version to another
+	// release channel.
+	SetChannel(pluginName string, version string, channel string) error
+	// SetYanked yanks or unyanks the axe with the given pluginName and version.
+	SetYanked(pluginName string, version string, yanked bool) error
+	// Delete removes the axes with the given pluginName and version from the
+	// catalog, and returns them.
+	Delete(pluginName string, version string) ([]common.Axe_v2, error)
+	// Revision returns the current revision of the catalog.
+	Revision() (Revision, error)
+	// String returns a human readable description of the storage backend.
+	String() string
+	Close()
+}
+
+var (
+	ErrNotFound  = errors.New("No such axe in the catalog.")
+	ErrDuplicate = errors.New("An axe with the same pluginName and version is already in the catalog.")
+	ErrReadOnly  = errors.New("The catalog is open read-only.") //see OpenReadOnly
+)
+
+// platformOSes returns the values of Axe_v2.OSList that FindByPlatform looks for.
+func platformOSes(platform string) []string {
+	return []string{"any", common.ParsePlatform(platform).OS}
+}
+
+// Open returns the Catalog implementation selected by the database section of
+// the Relaxe configuration file.
+func Open(config *common.RelaxeConfig) (Catalog, error) {
+	switch config.Database.Type {
+	case "", "mongodb":
+		return NewMongoCatalog(config.Database.ConnectionString)
+	case "file":
+		return NewFileCatalog(config.Database.Path)
+	}
+	return nil, fmt.Errorf("Unknown Relaxe database type %v.", config.Database.Type)
+}
+
+// OpenReadOnly returns the Catalog like Open, but opening it creates no files,
+// indexes or documents, and changing it returns ErrReadOnly.
+func OpenReadOnly(config *common.RelaxeConfig) (Catalog, error) {
+	switch config.Database.Type {
+	case "", "mongodb":
+		return NewReadOnlyMongoCatalog(config.Database.ConnectionString)
+	case "file":
+		return NewReadOnlyFileCatalog(config.Database.Path)
+	}
+	return nil, fmt.Errorf("Unknown Relaxe database type %v.", config.Database.Type)
+}
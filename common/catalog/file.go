@@ -0,0 +1,310 @@
+/* === This file is part of Relaxe - <https://github.com/teo/relaxe> ===
+ *
+ *   Copyright 2013, Teo Mrnjavac <teo@kde.org>
+ *
+ *   Relaxe is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   Relaxe is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with Relaxe. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package catalog
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/teo/relaxe/common"
+	"github.com/teo/relaxe/common/util"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FileCatalog is an embedded catalog that keeps all the axe metadata in a
+// single JSON file. It needs no external services, and picks up changes made
+// to the file by other processes (e.g. makeaxe publishing to a running Relaxe).
+// Changes are made under an inter-process lock, see change.
+type FileCatalog struct {
+	path     string
+	readOnly bool
+	mutex    sync.Mutex
+	axes     []common.Axe_v2
+	modTime  time.Time
+	loads    int64 //times the axes were read or saved, see Revision
+}
+
+func NewFileCatalog(path string) (*FileCatalog, error) {
+	if path == "" {
+		return nil, fmt.Errorf("A path must be set for the file database.")
+	}
+
+	this := new(FileCatalog)
+	this.path = path
+	this.axes = []common.Axe_v2{}
+
+	lock, err := util.LockFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot lock catalog file %v. %v", path, err.Error())
+	}
+	defer lock.Unlock()
+
+	ex, err := util.ExistsFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if !ex {
+		err = this.save()
+	} else {
+		err = this.reload()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return this, nil
+}
+
+// NewReadOnlyFileCatalog opens the catalog file without creating it or its lock
+// file. A missing catalog file is an empty catalog. Reading needs no lock,
+// since save replaces the file atomically.
+func NewReadOnlyFileCatalog(path string) (*FileCatalog, error) {
+	if path == "" {
+		return nil, fmt.Errorf("A path must be set for the file database.")
+	}
+
+	this := new(FileCatalog)
+	this.path = path
+	this.readOnly = true
+	this.axes = []common.Axe_v2{}
+	if err := this.reload(); err != nil {
+		return nil, err
+	}
+	return this, nil
+}
+
+// reload reads the catalog file again if it was modified since we last read it.
+func (this *FileCatalog) reload() error {
+	st, err := os.Stat(this.path)
+	if this.readOnly && os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if st.ModTime().Equal(this.modTime) {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(this.path)
+	if err != nil {
+		return err
+	}
+	axes := []common.Axe_v2{}
+	if err = json.Unmarshal(data, &axes); err != nil {
+		return fmt.Errorf("Cannot unmarshal catalog file %v. JSON error: %v.", this.path, err.Error())
+	}
+	this.axes = axes
+	this.modTime = st.ModTime()
+	this.loads++
+	return nil
+}
+
+// save atomically replaces the catalog file with the current contents.
+func (this *FileCatalog) save() error {
+	data, err := json.MarshalIndent(this.axes, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(this.path), ".relaxe-catalog")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), this.path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	st, err := os.Stat(this.path)
+	if err != nil {
+		return err
+	}
+	this.modTime = st.ModTime()
+	this.loads++
+	return nil
+}
+
+// change reloads the catalog, applies apply and saves the catalog, all while
+// holding the lock on the catalog file, so that concurrent writers in other
+// processes don't overwrite each other's changes.
+func (this *FileCatalog) change(apply func() error) error {
+	if this.readOnly {
+		return ErrReadOnly
+	}
+
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	lock, err := util.LockFile(this.path)
+	if err != nil {
+		return fmt.Errorf("Cannot lock catalog file %v. %v", this.path, err.Error())
+	}
+	defer lock.Unlock()
+
+	this.modTime = time.Time{} //always reload, the modification time may be too coarse to see a recent change
+	if err = this.reload(); err != nil {
+		return err
+	}
+	if err = apply(); err != nil {
+		return err
+	}
+	return this.save()
+}
+
+func (this *FileCatalog) find(match func(axe *common.Axe_v2) bool) ([]common.Axe_v2, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	if err := this.reload(); err != nil {
+		return nil, err
+	}
+
+	result := []common.Axe_v2{}
+	for i := range this.axes {
+		if match(&this.axes[i]) {
+			result = append(result, this.axes[i])
+		}
+	}
+	return result, nil
+}
+
+func (this *FileCatalog) FindAll() ([]common.Axe_v2, error) {
+	return this.find(func(axe *common.Axe_v2) bool {
+		return true
+	})
+}
+
+func (this *FileCatalog) FindByPlatform(platform string) ([]common.Axe_v2, error) {
+	wanted := platformOSes(platform)
+	return this.find(func(axe *common.Axe_v2) bool {
+		for _, osName := range axe.OSList() {
+			if osName == wanted[0] || osName == wanted[1] {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func (this *FileCatalog) FindByPluginName(pluginName string) ([]common.Axe_v2, error) {
+	return this.find(func(axe *common.Axe_v2) bool {
+		return axe.PluginName == pluginName
+	})
+}
+
+func (this *FileCatalog) Insert(axe *common.Axe_v2) error {
+	return this.change(func() error {
+		for i := range this.axes {
+			if this.axes[i].PluginName == axe.PluginName && this.axes[i].Version == axe.Version {
+				return ErrDuplicate
+			}
+		}
+		this.axes = append(this.axes, *axe)
+		return nil
+	})
+}
+
+func (this *FileCatalog) CountByNameVersion(pluginName string, version string) (int, error) {
+	result, err := this.find(func(axe *common.Axe_v2) bool {
+		return axe.PluginName == pluginName && axe.Version == version
+	})
+	return len(result), err
+}
+
+// update applies set to every axe with the given pluginName and version, and
+// saves the catalog.
+func (this *FileCatalog) update(pluginName string, version string, set func(axe *common.Axe_v2)) error {
+	return this.change(func() error {
+		found := false
+		for i := range this.axes {
+			if this.axes[i].PluginName == pluginName && this.axes[i].Version == version {
+				set(&this.axes[i])
+				found = true
+			}
+		}
+		if !found {
+			return ErrNotFound
+		}
+		return nil
+	})
+}
+
+func (this *FileCatalog) SetChannel(pluginName string, version string, channel string) error {
+	return this.update(pluginName, version, func(axe *common.Axe_v2) {
+		axe.Channel = channel
+	})
+}
+
+func (this *FileCatalog) SetYanked(pluginName string, version string, yanked bool) error {
+	return this.update(pluginName, version, func(axe *common.Axe_v2) {
+		axe.Yanked = yanked
+	})
+}
+
+func (this *FileCatalog) Delete(pluginName string, version string) ([]common.Axe_v2, error) {
+	deleted := []common.Axe_v2{}
+	err := this.change(func() error {
+		kept := []common.Axe_v2{}
+		for _, axe := range this.axes {
+			if axe.PluginName == pluginName && axe.Version == version {
+				deleted = append(deleted, axe)
+			} else {
+				kept = append(kept, axe)
+			}
+		}
+		if len(deleted) == 0 {
+			return ErrNotFound
+		}
+		this.axes = kept
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return deleted, nil
+}
+
+// Revision changes whenever the axes are read again or saved. The modification
+// time alone may be too coarse to tell two quick saves apart, but it is when
+// the revision last changed.
+func (this *FileCatalog) Revision() (Revision, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	if err := this.reload(); err != nil {
+		return Revision{}, err
+	}
+	return Revision{fmt.Sprint(this.loads), this.modTime}, nil
+}
+
+func (this *FileCatalog) String() string {
+	return "file database at " + this.path
+}
+
+func (this *FileCatalog) Close() {}
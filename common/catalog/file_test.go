@@ -0,0 +1,89 @@
+/* === This file is part of Relaxe - <https://github.com/teo/relaxe> ===
+ *
+ *   Copyright 2013, Teo Mrnjavac <teo@kde.org>
+ *
+ *   Relaxe is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   Relaxe is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with Relaxe. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package catalog
+
+import (
+	"github.com/teo/relaxe/common"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestFileCatalogFindByPlatform(t *testing.T) {
+	c, err := NewFileCatalog(filepath.Join(t.TempDir(), "catalog.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, axe := range []common.Axe_v2{
+		{PluginName: "any", Version: "1", Platform: "any"},
+		{PluginName: "linux", Version: "1", Platform: "linux-x86_64"},
+		{PluginName: "mac", Version: "1", Platform: "darwin"},
+		{PluginName: "both", Version: "1", Platforms: []string{"win64", "macos-arm64"}},
+	} {
+		if err := c.Insert(&axe); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.Insert(&common.Axe_v2{PluginName: "any", Version: "1"}); err != ErrDuplicate {
+		t.Errorf("Insert() of a duplicate version = %v, want ErrDuplicate", err)
+	}
+
+	tests := []struct {
+		platform string
+		want     []string
+	}{
+		{"linux-arm64", []string{"any", "linux"}},
+		{"osx-x86_64", []string{"any", "both", "mac"}},
+		{"win32", []string{"any", "both"}},
+		{"haiku", []string{"any"}},
+	}
+	for _, test := range tests {
+		axes, err := c.FindByPlatform(test.platform)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := []string{}
+		for _, axe := range axes {
+			got = append(got, axe.PluginName)
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("FindByPlatform(%q) = %v, want %v", test.platform, got, test.want)
+		}
+	}
+}
+
+func TestReadOnlyFileCatalog(t *testing.T) {
+	dir := t.TempDir()
+	c, err := NewReadOnlyFileCatalog(filepath.Join(dir, "catalog.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if axes, err := c.FindAll(); err != nil || len(axes) != 0 {
+		t.Errorf("FindAll() on a missing catalog file = %v, %v, want no axes", axes, err)
+	}
+	if err := c.Insert(&common.Axe_v2{PluginName: "foo", Version: "1"}); err != ErrReadOnly {
+		t.Errorf("Insert() = %v, want ErrReadOnly", err)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Errorf("read-only catalog created %v files", len(files))
+	}
+}
@@ -0,0 +1,209 @@
+/* === This file is part of Relaxe - <https://github.com/teo/relaxe> ===
+ *
+ *   Copyright 2013, Teo Mrnjavac <teo@kde.org>
+ *
+ *   Relaxe is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   Relaxe is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with Relaxe. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package catalog
+
+import (
+	"fmt"
+	"github.com/teo/relaxe/common"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"log"
+	"strings"
+	"time"
+)
+
+const revisionId = "revision"
+
+type MongoCatalog struct {
+	session  *mgo.Session
+	c        *mgo.Collection
+	meta     *mgo.Collection //holds the revision document
+	readOnly bool
+}
+
+func dialMongoCatalog(connectionString string) (*MongoCatalog, error) {
+	session, err := mgo.Dial(connectionString)
+	if err != nil {
+		return nil, err
+	}
+
+	this := new(MongoCatalog)
+	this.session = session
+	this.c = session.DB("relaxe").C("axes")
+	this.meta = session.DB("relaxe").C("meta")
+	return this, nil
+}
+
+func NewMongoCatalog(connectionString string) (*MongoCatalog, error) {
+	this, err := dialMongoCatalog(connectionString)
+	if err != nil {
+		return nil, err
+	}
+
+	// Makes Insert fail for a concurrent publish of the same version, which
+	// CountByNameVersion can't catch
+	err = this.c.EnsureIndex(mgo.Index{Key: []string{"pluginname", "version"}, Unique: true})
+	if err != nil {
+		log.Printf("Warning: cannot create unique index on pluginName and version, "+
+			"remove duplicate versions from %v. %v\n", this.c.FullName, err.Error())
+	}
+
+	if err = this.indexOSes(); err != nil {
+		this.session.Close()
+		return nil, err
+	}
+	return this, nil
+}
+
+// NewReadOnlyMongoCatalog connects without creating indexes or filling in the
+// oses field, see OpenReadOnly.
+func NewReadOnlyMongoCatalog(connectionString string) (*MongoCatalog, error) {
+	this, err := dialMongoCatalog(connectionString)
+	if err != nil {
+		return nil, err
+	}
+	this.readOnly = true
+	return this, nil
+}
+
+// indexOSes fills in the oses field of axes inserted before there was one, and
+// indexes it for FindByPlatform.
+func (this *MongoCatalog) indexOSes() error {
+	var doc struct {
+		Id        interface{} `bson:"_id"`
+		Platform  string      `bson:"platform"`
+		Platforms []string    `bson:"platforms"`
+	}
+	iter := this.c.Find(bson.M{"oses": bson.M{"$exists": false}}).Iter()
+	for iter.Next(&doc) {
+		axe := common.Axe_v2{Platform: doc.Platform, Platforms: doc.Platforms}
+		if err := this.c.UpdateId(doc.Id, bson.M{"$set": bson.M{"oses": axe.OSList()}}); err != nil {
+			iter.Close()
+			return err
+		}
+	}
+	if err := iter.Close(); err != nil {
+		return err
+	}
+	return this.c.EnsureIndexKey("oses")
+}
+
+// bump increments the catalog revision after a successful change.
+func (this *MongoCatalog) bump(err error) error {
+	if err != nil {
+		return err
+	}
+	_, err = this.meta.UpsertId(revisionId, bson.M{
+		"$inc": bson.M{"number": 1},
+		"$set": bson.M{"modified": time.Now()}})
+	return err
+}
+
+func (this *MongoCatalog) Revision() (Revision, error) {
+	var doc struct {
+		Number   int64     `bson:"number"`
+		Modified time.Time `bson:"modified"`
+	}
+	err := this.meta.FindId(revisionId).One(&doc)
+	if err == mgo.ErrNotFound {
+		return Revision{Id: "0"}, nil
+	}
+	return Revision{fmt.Sprint(doc.Number), doc.Modified}, err
+}
+
+func (this *MongoCatalog) FindAll() ([]common.Axe_v2, error) {
+	result := []common.Axe_v2{}
+	err := this.c.Find(nil).All(&result)
+	return result, err
+}
+
+func (this *MongoCatalog) FindByPlatform(platform string) ([]common.Axe_v2, error) {
+	result := []common.Axe_v2{}
+	err := this.c.Find(bson.M{"oses": bson.M{"$in": platformOSes(platform)}}).All(&result)
+	return result, err
+}
+
+func (this *MongoCatalog) FindByPluginName(pluginName string) ([]common.Axe_v2, error) {
+	result := []common.Axe_v2{}
+	err := this.c.Find(bson.M{"pluginname": pluginName}).All(&result)
+	return result, err
+}
+
+// updateAll sets fields on every axe with the given pluginName and version,
+// e.g. the axes for each platform.
+func (this *MongoCatalog) updateAll(pluginName string, version string, fields bson.M) error {
+	if this.readOnly {
+		return ErrReadOnly
+	}
+	info, err := this.c.UpdateAll(bson.M{"pluginname": pluginName, "version": version}, bson.M{"$set": fields})
+	if err == nil && info.Matched == 0 {
+		return ErrNotFound
+	}
+	return this.bump(err)
+}
+
+func (this *MongoCatalog) Insert(axe *common.Axe_v2) error {
+	if this.readOnly {
+		return ErrReadOnly
+	}
+	doc := *axe
+	doc.OSes = axe.OSList()
+	err := this.c.Insert(&doc)
+	if mgo.IsDup(err) {
+		return ErrDuplicate
+	}
+	return this.bump(err)
+}
+
+func (this *MongoCatalog) CountByNameVersion(pluginName string, version string) (int, error) {
+	return this.c.Find(bson.M{"pluginname": pluginName, "version": version}).Count()
+}
+
+func (this *MongoCatalog) SetChannel(pluginName string, version string, channel string) error {
+	return this.updateAll(pluginName, version, bson.M{"channel": channel})
+}
+
+func (this *MongoCatalog) SetYanked(pluginName string, version string, yanked bool) error {
+	return this.updateAll(pluginName, version, bson.M{"yanked": yanked})
+}
+
+func (this *MongoCatalog) Delete(pluginName string, version string) ([]common.Axe_v2, error) {
+	if this.readOnly {
+		return nil, ErrReadOnly
+	}
+	query := bson.M{"pluginname": pluginName, "version": version}
+	result := []common.Axe_v2{}
+	if err := this.c.Find(query).All(&result); err != nil {
+		return nil, err
+	}
+	if len(result) == 0 {
+		return nil, ErrNotFound
+	}
+	_, err := this.c.RemoveAll(query)
+	return result, this.bump(err)
+}
+
+func (this *MongoCatalog) String() string {
+	return "MongoDB instance at " + strings.Join(this.session.LiveServers(), ", ") +
+		", collection " + this.c.FullName
+}
+
+func (this *MongoCatalog) Close() {
+	this.session.Close()
+}
@@ -25,19 +25,36 @@ import (
 	"io/ioutil"
 )
 
+type Publisher struct {
+	Name       string   `json:"name"`
+	Token      string   `json:"token"`
+	PublicKeys []string `json:"publicKeys"` //base64 ed25519 keys, as printed by makeaxe --export-key
+	Admin      bool     `json:"admin"`      //may use the /v1/admin/ endpoints
+}
+
 type RelaxeConfig struct {
 	CacheDirectory string `json:"cacheDirectory"`
 	Database       struct {
+		Type             string `json:"type"` //Allowed values: mongodb (default), file
 		ConnectionString string `json:"connectionString"`
+		Path             string `json:"path"` //only if type == file
 	} `json:"database"`
 	KvStore struct {
+		Type             string `json:"type"` //Allowed values: redis (default), file
 		ConnectionString string `json:"connectionString"`
+		Path             string `json:"path"` //only if type == file
 	} `json:"kvStore"`
 	Server struct {
 		Host      string `json:"host"`
 		Port      uint16 `json:"port"`
 		CachePath string `json:"cachePath"`
 	} `json:"server"`
+	Scrubber struct {
+		Interval      string `json:"interval"` //e.g. 24h, empty to only scrub on demand
+		DeleteOrphans bool   `json:"deleteOrphans"`
+	} `json:"scrubber"`
+	Publishers        []Publisher `json:"publishers"`
+	RequireSignatures bool        `json:"requireSignatures"`
 }
 
 func LoadConfig(path string) (*RelaxeConfig, error) {
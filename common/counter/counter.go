@@ -0,0 +1,48 @@
+/* === This file is part of Relaxe - <https://github.com/teo/relaxe> ===
+ *
+ *   Copyright 2013, Teo Mrnjavac <teo@kde.org>
+ *
+ *   Relaxe is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   Relaxe is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with Relaxe. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package counter
+
+import (
+	"fmt"
+	"github.com/teo/relaxe/common"
+)
+
+// Counter keeps track of how many times each plugin has been downloaded.
+// Implementations must be safe for concurrent use.
+type Counter interface {
+	// Get returns the download count for pluginName, 0 if it was never downloaded.
+	Get(pluginName string) (int64, error)
+	// Incr increments the download count for pluginName and returns the new value.
+	Incr(pluginName string) (int64, error)
+	// Set replaces the download count for pluginName.
+	Set(pluginName string, count int64) error
+	Close()
+}
+
+// Open returns the Counter implementation selected by the kvStore section of
+// the Relaxe configuration file.
+func Open(config *common.RelaxeConfig) (Counter, error) {
+	switch config.KvStore.Type {
+	case "", "redis":
+		return NewRedisCounter(config.KvStore.ConnectionString)
+	case "file":
+		return NewFileCounter(config.KvStore.Path)
+	}
+	return nil, fmt.Errorf("Unknown Relaxe kvStore type %v.", config.KvStore.Type)
+}
@@ -0,0 +1,197 @@
+/* === This file is part of Relaxe - <https://github.com/teo/relaxe> ===
+ *
+ *   Copyright 2013, Teo Mrnjavac <teo@kde.org>
+ *
+ *   Relaxe is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   Relaxe is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with Relaxe. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package counter
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/teo/relaxe/common/util"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const flushInterval = 10 * time.Second
+
+// FileCounter keeps download counts in memory and periodically adds them to a
+// JSON file, so that Relaxe can run without Redis. The file is only changed
+// under an inter-process lock, and a flush adds the downloads counted since the
+// last one to what is in the file, so relaxectl can set counts while Relaxe is
+// running.
+type FileCounter struct {
+	path    string
+	mutex   sync.Mutex
+	counts  map[string]int64 //as of the last flush, plus pending
+	pending map[string]int64 //downloads counted since the last flush
+	done    chan bool
+}
+
+func NewFileCounter(path string) (*FileCounter, error) {
+	if path == "" {
+		return nil, fmt.Errorf("A path must be set for the file kvStore.")
+	}
+
+	this := new(FileCounter)
+	this.path = path
+	this.pending = map[string]int64{}
+	this.done = make(chan bool)
+
+	counts, err := this.load()
+	if err != nil {
+		return nil, err
+	}
+	this.counts = counts
+
+	go this.flushLoop()
+	return this, nil
+}
+
+// load reads the counts from disk.
+func (this *FileCounter) load() (map[string]int64, error) {
+	counts := map[string]int64{}
+	ex, err := util.ExistsFile(this.path)
+	if err != nil || !ex {
+		return counts, err
+	}
+	data, err := ioutil.ReadFile(this.path)
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, &counts); err != nil {
+		return nil, fmt.Errorf("Cannot unmarshal download counts file %v. JSON error: %v.", this.path, err.Error())
+	}
+	return counts, nil
+}
+
+func (this *FileCounter) flushLoop() {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := this.flush(); err != nil {
+				log.Println("Error: cannot write download counts. " + err.Error())
+			}
+		case <-this.done:
+			return
+		}
+	}
+}
+
+// flush adds the pending downloads to the counts on disk, and picks up the
+// changes made there by other processes.
+func (this *FileCounter) flush() error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	if len(this.pending) == 0 {
+		counts, err := this.load()
+		if err != nil {
+			return err
+		}
+		this.counts = counts
+		return nil
+	}
+	return this.change(func(counts map[string]int64) {
+		for pluginName, n := range this.pending {
+			counts[pluginName] += n
+		}
+		this.pending = map[string]int64{}
+	})
+}
+
+// change reloads the counts, applies apply and atomically writes them back,
+// all while holding the lock on the counts file. The mutex must be held.
+func (this *FileCounter) change(apply func(counts map[string]int64)) error {
+	lock, err := util.LockFile(this.path)
+	if err != nil {
+		return fmt.Errorf("Cannot lock download counts file %v. %v", this.path, err.Error())
+	}
+	defer lock.Unlock()
+
+	counts, err := this.load()
+	if err != nil {
+		return err
+	}
+	apply(counts)
+
+	data, err := json.MarshalIndent(counts, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(this.path), ".relaxe-dlcount")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), this.path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	this.counts = counts
+	for pluginName, n := range this.pending {
+		this.counts[pluginName] += n
+	}
+	return nil
+}
+
+func (this *FileCounter) Get(pluginName string) (int64, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	return this.counts[pluginName], nil
+}
+
+func (this *FileCounter) Incr(pluginName string) (int64, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	this.counts[pluginName]++
+	this.pending[pluginName]++
+	return this.counts[pluginName], nil
+}
+
+// Set writes the new count to disk right away.
+func (this *FileCounter) Set(pluginName string, count int64) error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	return this.change(func(counts map[string]int64) {
+		counts[pluginName] = count
+		delete(this.pending, pluginName)
+	})
+}
+
+func (this *FileCounter) Close() {
+	close(this.done)
+	if err := this.flush(); err != nil {
+		log.Println("Error: cannot write download counts. " + err.Error())
+	}
+}
@@ -0,0 +1,90 @@
+/* === This file is part of Relaxe - <https://github.com/teo/relaxe> ===
+ *
+ *   Copyright 2013, Teo Mrnjavac <teo@kde.org>
+ *
+ *   Relaxe is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   Relaxe is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with Relaxe. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package counter
+
+import (
+	"github.com/garyburd/redigo/redis"
+	"time"
+)
+
+const keyPrefix = "dlcount_"
+
+// RedisCounter stores download counts in Redis through a connection pool.
+// Broken connections are dropped from the pool and replaced on the next
+// request, so Relaxe recovers on its own when Redis is restarted.
+type RedisCounter struct {
+	pool *redis.Pool
+}
+
+func NewRedisCounter(connectionString string) (*RedisCounter, error) {
+	this := new(RedisCounter)
+	this.pool = &redis.Pool{
+		MaxIdle:     8,
+		IdleTimeout: 4 * time.Minute,
+		Dial: func() (redis.Conn, error) {
+			return redis.Dial("tcp", connectionString)
+		},
+		TestOnBorrow: func(c redis.Conn, t time.Time) error {
+			if time.Since(t) < time.Minute {
+				return nil
+			}
+			_, err := c.Do("PING")
+			return err
+		},
+	}
+
+	// Fail early if Redis is unreachable at startup.
+	conn := this.pool.Get()
+	defer conn.Close()
+	if _, err := conn.Do("PING"); err != nil {
+		this.pool.Close()
+		return nil, err
+	}
+	return this, nil
+}
+
+func (this *RedisCounter) Get(pluginName string) (int64, error) {
+	conn := this.pool.Get()
+	defer conn.Close()
+
+	count, err := redis.Int64(conn.Do("GET", keyPrefix+pluginName))
+	if err == redis.ErrNil {
+		return 0, nil
+	}
+	return count, err
+}
+
+func (this *RedisCounter) Incr(pluginName string) (int64, error) {
+	conn := this.pool.Get()
+	defer conn.Close()
+
+	return redis.Int64(conn.Do("INCR", keyPrefix+pluginName))
+}
+
+func (this *RedisCounter) Set(pluginName string, count int64) error {
+	conn := this.pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("SET", keyPrefix+pluginName, count)
+	return err
+}
+
+func (this *RedisCounter) Close() {
+	this.pool.Close()
+}
@@ -0,0 +1,68 @@
+/* === This file is part of Relaxe - <https://github.com/teo/relaxe> ===
+ *
+ *   Copyright 2013, Teo Mrnjavac <teo@kde.org>
+ *
+ *   Relaxe is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   Relaxe is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with Relaxe. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package common
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+)
+
+// The path of the metadata file, relative to the root of a bundle directory or
+// of an axe archive.
+const MetadataPath = "content/metadata.json"
+
+// ReadPackageMetadata extracts and unmarshals the metadata file of an axe archive.
+func ReadPackageMetadata(z *zip.Reader) (*Axe_v2, error) {
+	for _, f := range z.File {
+		if f.Name != MetadataPath {
+			continue
+		}
+		r, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+
+		metadataBytes, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+
+		metadata := new(Axe_v2)
+		if err = json.Unmarshal(metadataBytes, metadata); err != nil {
+			return nil, fmt.Errorf("Cannot unmarshal metadata file %v. JSON error: %v.",
+				MetadataPath, err.Error())
+		}
+		return metadata, nil
+	}
+	return nil, fmt.Errorf("Cannot find metadata file %v in axe.", MetadataPath)
+}
+
+// PublishResult is what Relaxe answers to a publish request.
+type PublishResult struct {
+	Status     string `json:"status"` //Allowed values: published, accepted (dry run), skipped, rejected
+	PluginName string `json:"pluginName"`
+	Version    string `json:"version"`
+	AxeId      string `json:"axeId,omitempty"`
+	Reason     string `json:"reason,omitempty"`
+	// If the metadata failed validation
+	Problems MetadataProblems `json:"problems,omitempty"`
+}
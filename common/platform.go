@@ -0,0 +1,104 @@
+/* === This file is part of Relaxe - <https://github.com/teo/relaxe> ===
+ *
+ *   Copyright 2013, Teo Mrnjavac <teo@kde.org>
+ *
+ *   Relaxe is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   Relaxe is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with Relaxe. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package common
+
+import (
+	"strings"
+)
+
+// Platform is an operating system with an optional architecture, written
+// os-arch, e.g. linux-x86_64, or just os, e.g. osx.
+type Platform struct {
+	OS   string
+	Arch string //empty for any architecture
+}
+
+// Other names clients and bundles use for the same platform, whole or for the
+// operating system or architecture part.
+var platformAliases = map[string]string{
+	"win64": "windows-x86_64",
+}
+
+var osAliases = map[string]string{
+	"win":     "windows",
+	"win32":   "windows",
+	"windows": "windows",
+	"osx":     "osx",
+	"macos":   "osx",
+	"mac":     "osx",
+	"darwin":  "osx",
+	"linux":   "linux",
+}
+
+var archAliases = map[string]string{
+	"x86_64":  "x86_64",
+	"amd64":   "x86_64",
+	"x64":     "x86_64",
+	"x86":     "x86",
+	"i386":    "x86",
+	"i686":    "x86",
+	"arm64":   "arm64",
+	"aarch64": "arm64",
+	"arm":     "arm",
+	"armv7":   "arm",
+}
+
+func canonical(aliases map[string]string, name string) string {
+	if c, ok := aliases[name]; ok {
+		return c
+	}
+	return name
+}
+
+// ParsePlatform parses a platform string, resolving aliases, so that e.g.
+// Win32 and windows, or linux-amd64 and linux-x86_64, are the same.
+func ParsePlatform(s string) Platform {
+	s = canonical(platformAliases, strings.ToLower(strings.TrimSpace(s)))
+	osName, arch := s, ""
+	if i := strings.Index(s, "-"); i >= 0 {
+		osName, arch = s[:i], s[i+1:]
+	}
+	return Platform{canonical(osAliases, osName), canonical(archAliases, arch)}
+}
+
+func (this Platform) String() string {
+	if this.Arch == "" {
+		return this.OS
+	}
+	return this.OS + "-" + this.Arch
+}
+
+// IsAnyPlatform returns whether a declared platform means all of them.
+func IsAnyPlatform(declared string) bool {
+	return declared == "" || strings.EqualFold(declared, "any")
+}
+
+// PlatformMatches returns whether a client on the given platform can use
+// something declared for the declared platform. A platform without an
+// architecture matches all architectures, on either side.
+func PlatformMatches(declared string, client string) bool {
+	if IsAnyPlatform(declared) {
+		return true
+	}
+	d, c := ParsePlatform(declared), ParsePlatform(client)
+	if d.OS != c.OS {
+		return false
+	}
+	return d.Arch == "" || c.Arch == "" || d.Arch == c.Arch
+}
@@ -0,0 +1,131 @@
+/* === This file is part of Relaxe - <https://github.com/teo/relaxe> ===
+ *
+ *   Copyright 2013, Teo Mrnjavac <teo@kde.org>
+ *
+ *   Relaxe is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   Relaxe is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with Relaxe. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package common
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePlatform(t *testing.T) {
+	tests := []struct {
+		s    string
+		want Platform
+	}{
+		{"linux", Platform{"linux", ""}},
+		{" Linux-AMD64 ", Platform{"linux", "x86_64"}},
+		{"win32", Platform{"windows", ""}},
+		{"win64", Platform{"windows", "x86_64"}},
+		{"Win32-x86", Platform{"windows", "x86"}},
+		{"darwin-aarch64", Platform{"osx", "arm64"}},
+		{"macos", Platform{"osx", ""}},
+		{"haiku-x86", Platform{"haiku", "x86"}},
+	}
+	for _, test := range tests {
+		if got := ParsePlatform(test.s); got != test.want {
+			t.Errorf("ParsePlatform(%q) = %v, want %v", test.s, got, test.want)
+		}
+	}
+}
+
+func TestPlatformMatches(t *testing.T) {
+	tests := []struct {
+		declared string
+		client   string
+		want     bool
+	}{
+		{"", "linux", true},
+		{"ANY", "win32", true},
+		{"linux", "linux-x86_64", true},
+		{"linux-x86_64", "linux", true},
+		{"linux-amd64", "linux-x86_64", true},
+		{"linux-x86_64", "linux-arm64", false},
+		{"linux", "", false},
+		{"osx", "darwin-arm64", true},
+		{"win64", "win32-x86", false},
+		{"win64", "windows", true},
+		{"windows", "osx", false},
+	}
+	for _, test := range tests {
+		if got := PlatformMatches(test.declared, test.client); got != test.want {
+			t.Errorf("PlatformMatches(%q, %q) = %v, want %v", test.declared, test.client, got, test.want)
+		}
+	}
+}
+
+func TestAxePlatforms(t *testing.T) {
+	tests := []struct {
+		axe       Axe_v2
+		oses      []string
+		supported []string
+		other     []string
+	}{
+		{Axe_v2{}, []string{"any"}, []string{"linux", "win32"}, nil},
+		{Axe_v2{Platform: "linux-x86_64"}, []string{"linux"}, []string{"linux", "linux-amd64"}, []string{"linux-arm", "osx"}},
+		{Axe_v2{Platform: "ignored", Platforms: []string{"win32", "win64", "darwin"}}, []string{"windows", "osx"},
+			[]string{"windows-x86", "macos-arm64"}, []string{"linux", "ignored"}},
+		{Axe_v2{Platforms: []string{"linux", "any"}}, []string{"any"}, []string{"osx"}, nil},
+	}
+	for _, test := range tests {
+		if got := test.axe.OSList(); !reflect.DeepEqual(got, test.oses) {
+			t.Errorf("%v OSList() = %v, want %v", test.axe.PlatformList(), got, test.oses)
+		}
+		for _, platform := range test.supported {
+			if !test.axe.SupportsPlatform(platform) {
+				t.Errorf("%v doesn't support %v", test.axe.PlatformList(), platform)
+			}
+		}
+		for _, platform := range test.other {
+			if test.axe.SupportsPlatform(platform) {
+				t.Errorf("%v supports %v", test.axe.PlatformList(), platform)
+			}
+		}
+	}
+}
+
+func TestBinaryFor(t *testing.T) {
+	tests := []struct {
+		binaries []string //platforms
+		platform string
+		want     string //platform of the binary, empty for none
+	}{
+		{[]string{"linux", "linux-arm64", "win32"}, "linux-arm64", "linux-arm64"},
+		{[]string{"linux", "linux-arm64", "win32"}, "linux-x86_64", "linux"},
+		{[]string{"linux", "linux-arm64", "win32"}, "linux", "linux"},
+		{[]string{"linux", "linux-arm64", "win32"}, "windows-x86_64", "win32"},
+		{[]string{"linux", "linux-arm64", "win32"}, "osx", ""},
+		{[]string{"linux", "linux-amd64"}, "linux-x86_64", "linux-amd64"},
+		{[]string{"linux-arm64", "linux-x86_64"}, "linux-amd64", "linux-x86_64"},
+		{[]string{"linux-arm64", "linux-x86_64"}, "linux", ""},
+		{[]string{"linux-x86_64"}, "linux", "linux-x86_64"},
+	}
+	for _, test := range tests {
+		axe := Axe_v2{}
+		for _, platform := range test.binaries {
+			axe.Binaries = append(axe.Binaries, Binary{Platform: platform, Path: platform + ".so"})
+		}
+		got := ""
+		if b := axe.BinaryFor(test.platform); b != nil {
+			got = b.Platform
+		}
+		if got != test.want {
+			t.Errorf("%v: BinaryFor(%q) = %q, want %q", test.binaries, test.platform, got, test.want)
+		}
+	}
+}
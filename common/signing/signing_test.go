@@ -0,0 +1,111 @@
+/* === This file is part of Relaxe - <https://github.com/teo/relaxe> ===
+ *
+ *   Copyright 2013, Teo Mrnjavac <teo@kde.org>
+ *
+ *   Relaxe is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   Relaxe is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with Relaxe. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package signing
+
+import (
+	"crypto/ed25519"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestKeyFiles(t *testing.T) {
+	keyPath := filepath.Join(t.TempDir(), "key")
+	pub, err := GenerateKey(keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := LoadPrivateKey(keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !PublicKey(key).Equal(pub) {
+		t.Error("loaded private key doesn't match the generated public key")
+	}
+
+	decoded, err := DecodePublicKey(EncodePublicKey(pub) + "\n")
+	if err != nil || !decoded.Equal(pub) {
+		t.Errorf("DecodePublicKey(EncodePublicKey(pub)) = %v, %v", decoded, err)
+	}
+
+	badPath := filepath.Join(t.TempDir(), "bad")
+	if err := ioutil.WriteFile(badPath, []byte("bm90IGEga2V5\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadPrivateKey(badPath); err == nil {
+		t.Error("LoadPrivateKey accepted a file without a key")
+	}
+}
+
+func TestDecodePublicKey(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		encoded string
+		ok      bool
+	}{
+		{EncodePublicKey(pub), true},
+		{"  " + EncodePublicKey(pub) + "\n", true},
+		{"", false},
+		{"not base64!", false},
+		{"bm90IGEga2V5", false}, //base64, but too short
+	}
+	for _, test := range tests {
+		_, err := DecodePublicKey(test.encoded)
+		if (err == nil) != test.ok {
+			t.Errorf("DecodePublicKey(%q) error = %v, want ok %v", test.encoded, err, test.ok)
+		}
+	}
+}
+
+func TestSignVerify(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte("axe contents")
+	signature := Sign(priv, data)
+
+	tests := []struct {
+		name      string
+		key       ed25519.PublicKey
+		data      []byte
+		signature string
+		want      bool
+	}{
+		{"good", pub, data, signature, true},
+		{"trailing newline", pub, data, signature + "\n", true},
+		{"tampered data", pub, []byte("axe contentz"), signature, false},
+		{"other key", otherPub, data, signature, false},
+		{"empty signature", pub, data, "", false},
+		{"not base64", pub, data, "%%%", false},
+		{"truncated", pub, data, signature[:20], false},
+	}
+	for _, test := range tests {
+		if got := Verify(test.key, test.data, test.signature); got != test.want {
+			t.Errorf("%v: Verify() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+/* === This file is part of Relaxe - <https://github.com/teo/relaxe> ===
+ *
+ *   Copyright 2013, Teo Mrnjavac <teo@kde.org>
+ *
+ *   Relaxe is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   Relaxe is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with Relaxe. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package util
+
+import (
+	"os"
+)
+
+// FileLock is an exclusive lock on a file, shared between processes, e.g.
+// relaxectl, makeaxe and a running Relaxe. It is held on a separate lock file
+// next to the file, since the files we lock are replaced on every save.
+type FileLock struct {
+	file *os.File
+}
+
+// LockFile takes the lock for the file at path, waiting until no other
+// process holds it.
+func LockFile(path string) (*FileLock, error) {
+	f, err := os.OpenFile(path+".lock", os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err = lockFd(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &FileLock{f}, nil
+}
+
+func (this *FileLock) Unlock() error {
+	err := unlockFd(this.file)
+	if cerr := this.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
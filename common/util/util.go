@@ -20,11 +20,11 @@ package util
 
 import (
 	"crypto/md5"
+	"crypto/sha256"
 	"fmt"
+	"hash"
 	"io"
 	"os"
-	"strconv"
-	"strings"
 )
 
 func exists(path string) (bool, error) {
@@ -64,74 +64,29 @@ func ExistsFile(path string) (bool, error) {
 	return !st.IsDir(), nil
 }
 
-func Md5sum(filePath string) (string, error) {
+func fileSum(filePath string, h hash.Hash) error {
 	f, err := os.Open(filePath)
-	if err == nil {
-		defer f.Close()
-
-		h := md5.New()
-		if _, err := io.Copy(h, f); err == nil {
-			sum := h.Sum(nil)
-			return fmt.Sprintf("%x", sum), nil
-		}
+	if err != nil {
+		return err
 	}
-	return "", fmt.Errorf("Cannot open file %v to compute MD5 sum.", filePath)
-}
+	defer f.Close()
 
-func maxInt(a int, b int) int {
-	if a < b {
-		return b
-	}
-	return a
+	_, err = io.Copy(h, f)
+	return err
 }
 
-// returns -1 if first is less than second, 1 if first
-// is more than second, and 0 if they are equal
-func VersionCompare(first string, second string) (verdict int) {
-	verdict = 0
-
-	if first == second {
-		return
-	}
-
-	sFirst := strings.Split(first, ".")
-	sSecond := strings.Split(second, ".")
-
-	depth := maxInt(len(sFirst), len(sSecond))
-
-	if lf := len(sFirst); lf < len(sSecond) {
-		for i := 0; i < depth-lf; i++ {
-			sFirst = append(sFirst, "0")
-		}
-	}
-
-	if ls := len(sSecond); ls < len(sFirst) {
-		for i := 0; i < depth-ls; i++ {
-			sSecond = append(sSecond, "0")
-		}
+func Md5sum(filePath string) (string, error) {
+	h := md5.New()
+	if err := fileSum(filePath, h); err != nil {
+		return "", fmt.Errorf("Cannot open file %v to compute MD5 sum.", filePath)
 	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
 
-	for i := 0; i < depth; i++ {
-		a, er1 := strconv.ParseUint(sFirst[i], 10, 16)
-		b, er2 := strconv.ParseUint(sSecond[i], 10, 16)
-
-		if er1 == nil && er2 == nil {
-			if a < b {
-				verdict = -1
-				break
-			} else if b < a {
-				verdict = 1
-				break
-			}
-		} else { //fallback: string comparison
-			if sFirst[i] < sSecond[i] {
-				verdict = -1
-				break
-			} else if sSecond[i] < sFirst[i] {
-				verdict = 1
-				break
-			}
-		}
+func Sha256sum(filePath string) (string, error) {
+	h := sha256.New()
+	if err := fileSum(filePath, h); err != nil {
+		return "", fmt.Errorf("Cannot open file %v to compute SHA-256 sum.", filePath)
 	}
-	return
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
 }
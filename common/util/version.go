@@ -0,0 +1,296 @@
+/* === This file is part of Relaxe - <https://github.com/teo/relaxe> ===
+ *
+ *   Copyright 2013, Teo Mrnjavac <teo@kde.org>
+ *
+ *   Relaxe is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   Relaxe is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with Relaxe. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package util
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Version is a parsed version string. Parsing is lenient: anything that isn't
+// SemVer 2.0 is still split into dot-separated components, and components that
+// aren't numeric are compared as strings.
+type Version struct {
+	Core       []string
+	PreRelease []string
+	Build      string
+}
+
+func ParseVersion(s string) Version {
+	var v Version
+	s = strings.TrimPrefix(strings.TrimSpace(s), "v")
+
+	if i := strings.Index(s, "+"); i >= 0 {
+		v.Build = s[i+1:]
+		s = s[:i]
+	}
+	if i := strings.Index(s, "-"); i >= 0 {
+		v.PreRelease = strings.Split(s[i+1:], ".")
+		s = s[:i]
+	}
+	v.Core = strings.Split(s, ".")
+	return v
+}
+
+func isNumeric(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// compareNumeric compares two strings of digits of any length.
+func compareNumeric(a string, b string) int {
+	a = strings.TrimLeft(a, "0")
+	b = strings.TrimLeft(b, "0")
+	if len(a) != len(b) {
+		if len(a) < len(b) {
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// compareIdentifier compares two version components, numerically if both are
+// numbers. As in SemVer, numbers sort before anything else.
+func compareIdentifier(a string, b string) int {
+	na, nb := isNumeric(a), isNumeric(b)
+	switch {
+	case na && nb:
+		return compareNumeric(a, b)
+	case na:
+		return -1
+	case nb:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// Compare returns -1, 0 or 1 according to SemVer 2.0 precedence. Missing core
+// components count as 0, so "1.2" equals "1.2.0", and build metadata is ignored.
+func (this Version) Compare(other Version) int {
+	depth := len(this.Core)
+	if len(other.Core) > depth {
+		depth = len(other.Core)
+	}
+	for i := 0; i < depth; i++ {
+		a, b := "0", "0"
+		if i < len(this.Core) {
+			a = this.Core[i]
+		}
+		if i < len(other.Core) {
+			b = other.Core[i]
+		}
+		if c := compareIdentifier(a, b); c != 0 {
+			return c
+		}
+	}
+
+	// A pre-release version has lower precedence than the normal version.
+	switch {
+	case len(this.PreRelease) == 0 && len(other.PreRelease) == 0:
+		return 0
+	case len(this.PreRelease) == 0:
+		return 1
+	case len(other.PreRelease) == 0:
+		return -1
+	}
+	for i := 0; i < len(this.PreRelease) && i < len(other.PreRelease); i++ {
+		if c := compareIdentifier(this.PreRelease[i], other.PreRelease[i]); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case len(this.PreRelease) < len(other.PreRelease):
+		return -1
+	case len(this.PreRelease) > len(other.PreRelease):
+		return 1
+	}
+	return 0
+}
+
+// returns -1 if first is less than second, 1 if first
+// is more than second, and 0 if they are equal
+func VersionCompare(first string, second string) int {
+	if first == second {
+		return 0
+	}
+	return ParseVersion(first).Compare(ParseVersion(second))
+}
+
+type comparator struct {
+	op      string
+	version Version
+}
+
+func (this comparator) match(v Version) bool {
+	c := v.Compare(this.version)
+	switch this.op {
+	case "", "=", "==":
+		return c == 0
+	case "!=":
+		return c != 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	}
+	return false
+}
+
+// Constraint is a set of version requirements, e.g. ">=0.7 <0.9", "^1.2",
+// "~1.2.3", "1.x" or "<0.5 || >=0.7". Comparators separated by whitespace or
+// commas must all match, alternatives separated by "||" are OR'ed.
+type Constraint struct {
+	alternatives [][]comparator
+}
+
+var constraintOperators = []string{">=", "<=", "!=", "==", ">", "<", "=", "^", "~"}
+
+func splitOperator(s string) (string, string) {
+	for _, op := range constraintOperators {
+		if strings.HasPrefix(s, op) {
+			return op, s[len(op):]
+		}
+	}
+	return "", s
+}
+
+// bump returns the version with the component at index incremented and
+// everything after it dropped, as the lowest pre-release ("-0") so that
+// pre-releases of the bumped version don't match.
+func bump(core []string, index int) Version {
+	bumped := make([]string, index+1)
+	copy(bumped, core)
+	for len(bumped) <= index {
+		bumped = append(bumped, "0")
+	}
+	n := 0
+	fmt.Sscanf(bumped[index], "%d", &n)
+	bumped[index] = fmt.Sprint(n + 1)
+	return Version{Core: bumped, PreRelease: []string{"0"}}
+}
+
+// expandComparator turns a single constraint term into plain comparators.
+func expandComparator(term string) ([]comparator, error) {
+	op, versionString := splitOperator(term)
+	if versionString == "" {
+		return nil, fmt.Errorf("Bad version constraint %v.", term)
+	}
+	v := ParseVersion(versionString)
+
+	// Wildcards: "*", "1.x", "1.2.*"
+	for i, c := range v.Core {
+		if c == "*" || c == "x" || c == "X" {
+			if i == 0 {
+				return []comparator{}, nil
+			}
+			lower := Version{Core: v.Core[:i]}
+			return []comparator{{">=", lower}, {"<", bump(v.Core, i-1)}}, nil
+		}
+	}
+
+	switch op {
+	case "^":
+		// Changes that don't modify the left-most non-zero component.
+		index := len(v.Core) - 1
+		for i, c := range v.Core {
+			if c != "0" {
+				index = i
+				break
+			}
+		}
+		return []comparator{{">=", v}, {"<", bump(v.Core, index)}}, nil
+	case "~":
+		// Patch level changes if a minor version is given, minor level otherwise.
+		index := 0
+		if len(v.Core) > 1 {
+			index = 1
+		}
+		return []comparator{{">=", v}, {"<", bump(v.Core, index)}}, nil
+	}
+	return []comparator{{op, v}}, nil
+}
+
+func ParseConstraint(s string) (*Constraint, error) {
+	this := new(Constraint)
+	for _, alternative := range strings.Split(s, "||") {
+		terms := strings.Fields(strings.Replace(alternative, ",", " ", -1))
+		comparators := []comparator{}
+		for i := 0; i < len(terms); i++ {
+			term := terms[i]
+			// Allow whitespace between an operator and its version, e.g. ">= 0.7"
+			if op, rest := splitOperator(term); op != "" && rest == "" && i+1 < len(terms) {
+				i++
+				term += terms[i]
+			}
+			expanded, err := expandComparator(term)
+			if err != nil {
+				return nil, err
+			}
+			comparators = append(comparators, expanded...)
+		}
+		this.alternatives = append(this.alternatives, comparators)
+	}
+	return this, nil
+}
+
+func (this *Constraint) Match(version string) bool {
+	v := ParseVersion(version)
+	for _, comparators := range this.alternatives {
+		matched := true
+		for _, c := range comparators {
+			if !c.match(v) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// VersionSatisfies returns whether version meets requirement, which is either a
+// version constraint or, as in older metadata, a bare minimum version.
+func VersionSatisfies(version string, requirement string) bool {
+	if strings.TrimSpace(requirement) == "" {
+		return true
+	}
+
+	c, err := ParseConstraint(requirement)
+	if err != nil {
+		return false
+	}
+	if len(c.alternatives) == 1 && len(c.alternatives[0]) == 1 && c.alternatives[0][0].op == "" {
+		return ParseVersion(version).Compare(c.alternatives[0][0].version) >= 0
+	}
+	return c.Match(version)
+}
@@ -0,0 +1,151 @@
+/* === This file is part of Relaxe - <https://github.com/teo/relaxe> ===
+ *
+ *   Copyright 2013, Teo Mrnjavac <teo@kde.org>
+ *
+ *   Relaxe is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   Relaxe is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with Relaxe. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package util
+
+import (
+	"testing"
+)
+
+func TestVersionCompare(t *testing.T) {
+	tests := []struct {
+		first  string
+		second string
+		want   int
+	}{
+		{"1.0.0", "1.0.0", 0},
+		{"1.0", "1.0.0", 0},
+		{"v1.2.3", "1.2.3", 0},
+		{"1.01", "1.1", 0},
+		{"1.0.0+build5", "1.0.0", 0},
+		{"1.0.0+build5", "1.0.0+build6", 0},
+		{"1.0.1", "1.0.0", 1},
+		{"0.10.0", "0.9.10", 1},
+		{"2.10", "2.9", 1},
+		{"2.10", "2.9-rc1", 1},
+		{"10000000000000000000.0", "9.0", 1},
+		{"1.0.0-rc.1", "1.0.0", -1},
+		{"1.0.0-beta.2", "1.0.0-beta.11", -1},
+		{"1.0.0-alpha", "1.0.0-alpha.1", -1},
+		{"1.0.0-alpha.1", "1.0.0-alpha.beta", -1},
+		{"1.0.0-beta.2+build", "1.0.0-beta.2", 0},
+	}
+	for _, test := range tests {
+		if got := VersionCompare(test.first, test.second); got != test.want {
+			t.Errorf("VersionCompare(%v, %v) = %v, want %v", test.first, test.second, got, test.want)
+		}
+		if got := VersionCompare(test.second, test.first); got != -test.want {
+			t.Errorf("VersionCompare(%v, %v) = %v, want %v", test.second, test.first, got, -test.want)
+		}
+	}
+}
+
+// The precedence example of the SemVer 2.0 specification.
+func TestVersionPrecedence(t *testing.T) {
+	ordered := []string{"1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta",
+		"1.0.0-beta.2", "1.0.0-beta.11", "1.0.0-rc.1", "1.0.0"}
+	for i := range ordered {
+		for j := range ordered {
+			want := 0
+			if i < j {
+				want = -1
+			} else if i > j {
+				want = 1
+			}
+			if got := VersionCompare(ordered[i], ordered[j]); got != want {
+				t.Errorf("VersionCompare(%v, %v) = %v, want %v", ordered[i], ordered[j], got, want)
+			}
+		}
+	}
+}
+
+func TestVersionSatisfies(t *testing.T) {
+	tests := []struct {
+		version     string
+		requirement string
+		want        bool
+	}{
+		{"1.0", "", true},
+
+		// A bare version is a minimum, as in older metadata
+		{"0.7", "0.7", true},
+		{"0.7.0", "0.7", true},
+		{"0.8", "0.7", true},
+		{"0.6", "0.7", false},
+
+		{"1.0", "=1.0", true},
+		{"1.0.1", "==1.0", false},
+		{"1.0.1", "!=1.0", true},
+
+		{"0.7", ">=0.7 <0.9", true},
+		{"0.8", ">=0.7 <0.9", true},
+		{"0.6.9", ">=0.7 <0.9", false},
+		{"0.9", ">=0.7 <0.9", false},
+		{"0.8", ">= 0.7, < 0.9", true},
+
+		{"1.2.0", "^1.2", true},
+		{"1.5.0", "^1.2", true},
+		{"1.1.9", "^1.2", false},
+		{"2.0.0", "^1.2", false},
+		{"2.0.0-beta", "^1.2", false},
+		{"0.2.5", "^0.2.3", true},
+		{"0.3.0", "^0.2.3", false},
+
+		{"1.2.9", "~1.2.3", true},
+		{"1.2.2", "~1.2.3", false},
+		{"1.3.0", "~1.2.3", false},
+		{"1.9", "~1", true},
+		{"2.0", "~1", false},
+
+		{"1.4", "1.x", true},
+		{"2.0", "1.x", false},
+		{"1.2.7", "1.2.*", true},
+		{"1.3.0", "1.2.*", false},
+		{"3.0", "*", true},
+
+		{"0.4", "<0.5 || >=0.7", true},
+		{"0.6", "<0.5 || >=0.7", false},
+		{"0.8", "<0.5 || >=0.7", true},
+
+		{"1.0", ">=", false},
+	}
+	for _, test := range tests {
+		if got := VersionSatisfies(test.version, test.requirement); got != test.want {
+			t.Errorf("VersionSatisfies(%v, %q) = %v, want %v", test.version, test.requirement, got, test.want)
+		}
+	}
+}
+
+func TestParseConstraint(t *testing.T) {
+	tests := []struct {
+		constraint string
+		ok         bool
+	}{
+		{">=0.7 <0.9", true},
+		{">= 0.7", true},
+		{"^1.2 || ~2.0", true},
+		{">=", false},
+		{"1.0 || <", false},
+	}
+	for _, test := range tests {
+		_, err := ParseConstraint(test.constraint)
+		if (err == nil) != test.ok {
+			t.Errorf("ParseConstraint(%q) error = %v, want ok %v", test.constraint, err, test.ok)
+		}
+	}
+}
@@ -23,12 +23,13 @@ import (
 	"fmt"
 	"github.com/nu7hatch/gouuid"
 	"github.com/teo/relaxe/common"
+	"github.com/teo/relaxe/common/cache"
+	"github.com/teo/relaxe/common/catalog"
 	"github.com/teo/relaxe/common/util"
 	"github.com/teo/relaxe/makeaxe/bundle"
-	"gopkg.in/mgo.v2"
-	"gopkg.in/mgo.v2/bson"
 	"io/ioutil"
 	"log"
+	"os"
 	"path"
 	"strings"
 )
@@ -60,44 +61,73 @@ func preparePaths(inputPath string) []string {
 	return inputList
 }
 
-func buildToRelaxe(inputList []string, relaxeConfig common.RelaxeConfig) string {
+// loadBundle loads the bundle in inputDirPath and sets it up for packaging
+// according to the command line options.
+func loadBundle(inputDirPath string, out *buildOutput) (*bundle.Bundle, error) {
+	b, err := bundle.LoadBundle(inputDirPath, out)
+	if err != nil {
+		out.Logf("Warning: could not load bundle from directory %v.\n", inputDirPath)
+		out.Logf("\tStatus: %v", err)
+		if _, ok := err.(*common.MetadataError); ok { //always show what needs fixing
+			out.Printf("%v\n", err.Error())
+		}
+		return nil, err
+	}
+
+	b.SigningKey = signingKey
+	b.Reproducible = reproducible
+	if relaxe && channel != "" {
+		b.Metadata.Channel = channel
+	}
+	return b, nil
+}
+
+func buildToRelaxe(inputList []string, relaxeConfig common.RelaxeConfig) (string, []buildResult) {
 	if !relaxe {
 		die("Error: cannot push to Relaxe in directory mode.")
 	}
 
-	// Try to connect to the MongoDB instance first, bail out if we can't
-	session, err := mgo.Dial(relaxeConfig.Database.ConnectionString)
+	// Try to open the Relaxe catalog first, bail out if we can't
+	open := catalog.Open
+	if dryRun { //don't create the catalog or anything else in it
+		open = catalog.OpenReadOnly
+	}
+	c, err := open(&relaxeConfig)
 	if err != nil {
 		die("Error: cannot connect to Relaxe database. Reason: " + err.Error())
 	}
-	c := session.DB("relaxe").C("axes")
+	defer c.Close()
 
-	log.Println("Connected to Relaxe MongoDB instance, collections: " + c.FullName)
-
-	built := []string{}
-	errors := []string{}
-	skipped := []string{}
+	log.Println("Connected to Relaxe catalog: " + c.String())
 
 	outputPath := relaxeConfig.CacheDirectory
-	for _, inputDirPath := range inputList {
-		b, err := bundle.LoadBundle(inputDirPath)
+	published := newClaims()
+
+	results := buildEach(inputList, func(inputDirPath string, out *buildOutput) buildResult {
+		b, err := loadBundle(inputDirPath, out)
 		if err != nil {
-			log.Printf("Warning: could not load bundle from directory %v.\n", inputDirPath)
-			skipped = append(skipped, path.Base(inputDirPath))
-			continue
+			return errorResult(nil, err.Error())
 		}
 
-		count, err := c.Find(bson.M{"pluginname": b.Metadata.PluginName, "version": b.Metadata.Version}).Count()
+		count, err := c.CountByNameVersion(b.Metadata.PluginName, b.Metadata.Version)
 
 		if err != nil {
-			log.Printf("Warning: Relaxe database error. %v\n", err.Error())
-			errors = append(errors, path.Base(inputDirPath))
-			continue
+			out.Logf("Warning: Relaxe database error. %v\n", err.Error())
+			return errorResult(b, "Relaxe database error. "+err.Error())
 		}
-		if count != 0 { //if Relaxe already has axes of the same pluginName and version
-			log.Printf("Warning: axe %v-%v is already published on Relaxe, skipping.\n", b.Metadata.PluginName, b.Metadata.Version)
-			skipped = append(skipped, path.Base(inputDirPath))
-			continue
+		if count != 0 || !published.claim(b.Metadata.PluginName+"-"+b.Metadata.Version) { //if Relaxe already has axes of the same pluginName and version
+			out.Logf("Warning: axe %v-%v is already published on Relaxe, skipping.\n", b.Metadata.PluginName, b.Metadata.Version)
+			r := skippedResult(b, "Already published on Relaxe.")
+			r.outputPath = publishedPath(c, outputPath, b.Metadata)
+			return r
+		}
+
+		if dryRun {
+			if err := b.Check(); err != nil {
+				out.Logf("Warning: could not build axe for directory %v. %v\n", path.Base(inputDirPath), err.Error())
+				return errorResult(b, err.Error())
+			}
+			return builtResult(b, "", b.Metadata.PluginName+"-"+b.Metadata.Version)
 		}
 
 		u, err := uuid.NewV4()
@@ -107,85 +137,201 @@ func buildToRelaxe(inputList []string, relaxeConfig common.RelaxeConfig) string
 
 		outputFilePath, err := b.CreatePackage(outputPath, true /*release*/, false /*force*/)
 		if err != nil {
-			log.Printf("Warning: could not build axe for directory %v.\n", path.Base(inputDirPath))
-			errors = append(errors, path.Base(inputDirPath))
-			continue
+			out.Logf("Warning: could not build axe for directory %v.\n", path.Base(inputDirPath))
+			return errorResult(b, err.Error())
 		}
-		log.Printf("* Created axe in %v.\n", outputFilePath)
+		out.Logf("* Created axe in %v.\n", outputFilePath)
+
+		b.Metadata.Downloads = nil
+		b.Metadata.Yanked = false
+		b.Metadata.Signature = b.Signature
+		b.Metadata.Sha256 = b.Sha256
 
 		mrshld, _ := json.MarshalIndent(b.Metadata, "", "  ")
-		log.Println("* Pushing to Relaxe:\n" + string(mrshld))
+		out.Logf("* Pushing to Relaxe:\n%v\n", string(mrshld))
 		err = c.Insert(b.Metadata)
-		if err != nil {
-			log.Println(err.Error())
+		if err == catalog.ErrDuplicate { //published concurrently since we counted
+			cache.Remove(outputPath, b.Metadata)
+			out.Logf("Warning: axe %v-%v is already published on Relaxe, skipping.\n", b.Metadata.PluginName, b.Metadata.Version)
+			return skippedResult(b, "Already published on Relaxe.")
+		} else if err != nil {
+			cache.Remove(outputPath, b.Metadata)
+			out.Logf("Warning: Relaxe database error. %v\n", err.Error())
+			return errorResult(b, "Relaxe database error. "+err.Error())
 		}
 
-		built = append(built, "UUID:"+axeUuid+"\t"+b.Metadata.PluginName+"-"+b.Metadata.Version)
-	}
+		return builtResult(b, outputFilePath, "UUID:"+axeUuid+"\t"+b.Metadata.PluginName+"-"+b.Metadata.Version)
+	})
 
-	if ex, err := util.ExistsFile(path.Join(outputPath, "index.html")); !ex && err == nil {
-		indexText := fmt.Sprintf("<html><head><title>Relaxe server</title></head>" +
-			"<body>Relaxe cache directory. Move along, nothing to see here.</body></html>")
-		err := ioutil.WriteFile(path.Join(outputPath, "index.html"), []byte(indexText), 0644)
-		if err != nil {
+	if !dryRun {
+		if err := cache.EnsureIndex(outputPath); err != nil {
 			log.Printf("Warning: could not write Relaxe index file.\n")
 		}
 	}
 
-	preamble := fmt.Sprintf("Relaxe instance at %v; pushing to cache directory: %v\n", strings.Join(session.LiveServers(), ", "), outputPath)
-	return makeSummary(preamble, built, errors, skipped)
+	preamble := fmt.Sprintf("Relaxe catalog: %v; pushing to cache directory: %v\n", c.String(), outputPath)
+	return makeSummary(preamble, results), results
+}
+
+// publishedPath returns the path of the axe with the same pluginName and version
+// as metadata in the Relaxe cache directory, or "" if there is none.
+func publishedPath(c catalog.Catalog, cacheDir string, metadata *common.Axe_v2) string {
+	axes, err := c.FindByPluginName(metadata.PluginName)
+	if err != nil {
+		return ""
+	}
+	for i := range axes {
+		if axes[i].Version == metadata.Version {
+			return path.Join(cacheDir, cache.AxeFileName(&axes[i]))
+		}
+	}
+	return ""
+}
+
+func buildToRemoteRelaxe(inputList []string, serverUrl string) (string, []buildResult) {
+	if !relaxe {
+		die("Error: cannot push to Relaxe in directory mode.")
+	}
+	if token == "" {
+		die("Error: a publisher token (--token, -t) is required to publish to a Relaxe server.")
+	}
+
+	tempDirPath, err := ioutil.TempDir("", "makeaxe")
+	if err != nil {
+		die("Error: cannot create temporary directory. Reason: " + err.Error())
+	}
+	defer os.RemoveAll(tempDirPath)
+
+	published := newClaims()
+
+	results := buildEach(inputList, func(inputDirPath string, out *buildOutput) buildResult {
+		b, err := loadBundle(inputDirPath, out)
+		if err != nil {
+			return errorResult(nil, err.Error())
+		}
+		if !published.claim(b.OutputFileName()) {
+			out.Logf("Warning: axe %v-%v is already being published, skipping.\n", b.Metadata.PluginName, b.Metadata.Version)
+			return skippedResult(b, "Already published from another directory.")
+		}
+
+		outputFilePath, err := b.CreatePackage(tempDirPath, true /*release*/, true /*force*/)
+		if err != nil {
+			out.Logf("Warning: could not build axe for directory %v. %v\n", path.Base(inputDirPath), err.Error())
+			return errorResult(b, err.Error())
+		}
+		out.Logf("* Created axe in %v.\n", outputFilePath)
+
+		result, err := publishPackage(serverUrl, token, outputFilePath, b.Signature, dryRun)
+		if err != nil {
+			out.Logf("Warning: could not publish axe for directory %v. %v\n", path.Base(inputDirPath), err.Error())
+			return errorResult(b, err.Error())
+		}
+
+		switch result.Status {
+		case "published":
+			b.Metadata.AxeId = result.AxeId
+			return builtResult(b, "", "UUID:"+result.AxeId+"\t"+result.PluginName+"-"+result.Version)
+		case "accepted":
+			return builtResult(b, "", result.PluginName+"-"+result.Version)
+		case "skipped":
+			out.Logf("Warning: axe %v-%v is already published on Relaxe, skipping.\n", result.PluginName, result.Version)
+			return skippedResult(b, result.Reason)
+		default:
+			out.Logf("Warning: Relaxe rejected axe %v-%v. %v\n", result.PluginName, result.Version, result.Reason)
+			if len(result.Problems) != 0 {
+				out.Printf("Relaxe rejected metadata for %v-%v:\n    * %v\n", result.PluginName, result.Version,
+					strings.Join(result.Problems.Strings(), "\n    * "))
+			}
+			return errorResult(b, strings.Join(append([]string{result.Reason}, result.Problems.Strings()...), "\n"))
+		}
+	})
+
+	return makeSummary("Relaxe server: "+serverUrl+"\n", results), results
 }
 
-func buildToDirectory(inputList []string, outputPath string) string {
+func buildToDirectory(inputList []string, outputPath string) (string, []buildResult) {
 	if relaxe {
 		die("Error: cannot build to directory in Relaxe mode.")
 	}
 
-	built := []string{}
-	errors := []string{}
-	skipped := []string{}
+	state := loadBuildState(outputPath)
+	created := newClaims()
+
+	results := buildEach(inputList, func(inputDirPath string, out *buildOutput) buildResult {
+		b, err := loadBundle(inputDirPath, out)
+		if err != nil {
+			return errorResult(nil, err.Error())
+		}
+		if !created.claim(b.OutputFileName()) {
+			out.Logf("Warning: axe %v was already built from another directory, skipping.\n", b.OutputFileName())
+			return skippedResult(b, "Already built from another directory.")
+		}
 
-	for _, inputDirPath := range inputList {
-		b, err := bundle.LoadBundle(inputDirPath)
+		// Rebuild existing axes whose sources or build options changed, even if
+		// the version didn't
+		inputHash, err := b.InputHash(release)
 		if err != nil {
-			log.Printf("Warning: could not load bundle from directory %v.\n", inputDirPath)
-			log.Printf("\tStatus: %v", err)
-			skipped = append(skipped, path.Base(inputDirPath))
-			continue
+			out.Logf("Warning: could not read sources for directory %v. %v\n", path.Base(inputDirPath), err.Error())
+			return errorResult(b, err.Error())
 		}
-		outputFilePath, err := b.CreatePackage(outputPath, release, force)
+		rebuild := force || state.changed(b.OutputFileName(), inputHash)
+
+		outputFilePath, err := b.CreatePackage(outputPath, release, rebuild)
 		if err != nil {
-			log.Printf("Warning: could not build axe for directory %v. %v\n", path.Base(inputDirPath), err.Error())
+			out.Logf("Warning: could not build axe for directory %v. %v\n", path.Base(inputDirPath), err.Error())
 			if outputFilePath != "" { //means we are not creating just because the axe already exists
-				skipped = append(skipped, path.Base(inputDirPath))
-			} else {
-				errors = append(errors, path.Base(inputDirPath))
+				r := skippedResult(b, "Up to date.")
+				r.outputPath = outputFilePath
+				return r
 			}
-			continue
+			return errorResult(b, err.Error())
 		}
-		log.Printf("* Created axe in %v.\n", outputFilePath)
-		built = append(built, path.Base(outputFilePath))
+		out.Logf("* Created axe in %v.\n", outputFilePath)
+		state.record(b.OutputFileName(), inputHash)
+		return builtResult(b, outputFilePath, path.Base(outputFilePath))
+	})
+
+	if err := state.save(); err != nil {
+		log.Printf("Warning: could not write build state file. %v\n", err.Error())
 	}
 
-	return makeSummary("Output directory: "+outputPath+"\n", built, errors, skipped)
+	return makeSummary("Output directory: "+outputPath+"\n", results), results
 }
 
-func makeSummary(preamble string, built []string, errors []string, skipped []string) string {
+func makeSummary(preamble string, results []buildResult) string {
+	built, errors, skipped := []string{}, []string{}, []string{}
+	for _, r := range results {
+		switch r.status {
+		case statusBuilt:
+			built = append(built, r.entry)
+		case statusError:
+			errors = append(errors, path.Base(r.directory))
+		case statusSkipped:
+			skipped = append(skipped, path.Base(r.directory))
+		}
+	}
+
 	var (
 		builtText   string
 		errorsText  string
 		skippedText string
 	)
+	builtLabel, errorsLabel := "Axes built", "Build errors"
+	if dryRun {
+		preamble = "Dry run, nothing was written or published.\n" + preamble
+		builtLabel, errorsLabel = "Axes to publish", "Axes rejected"
+	}
+
 	if len(built) == 0 {
-		builtText = fmt.Sprint("No axes built\n")
+		builtText = fmt.Sprintf("No %v\n", strings.ToLower(builtLabel))
 	} else {
-		builtText = fmt.Sprintf("Axes built: %v\n"+
-			"    * %v\n", len(built), strings.Join(built, "\n    * "))
+		builtText = fmt.Sprintf("%v: %v\n"+
+			"    * %v\n", builtLabel, len(built), strings.Join(built, "\n    * "))
 	}
 
 	if len(errors) != 0 {
-		errorsText = fmt.Sprintf("Build errors: %v\n"+
-			"    * %v\n", len(errors), strings.Join(errors, "\n    * "))
+		errorsText = fmt.Sprintf("%v: %v\n"+
+			"    * %v\n", errorsLabel, len(errors), strings.Join(errors, "\n    * "))
 	}
 
 	if len(skipped) != 0 {
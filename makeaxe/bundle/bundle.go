@@ -20,32 +20,114 @@ package bundle
 
 import (
 	"archive/zip"
+	"crypto/ed25519"
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"github.com/teo/relaxe/common"
+	"github.com/teo/relaxe/common/signing"
 	"github.com/teo/relaxe/common/util"
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
 	"os/exec"
 	"path"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
 
 const (
-	bundleVersion   = "2"
+	BundleVersion   = "2"
 	metadataRelPath = "content/metadata.json"
 )
 
+// Output receives the messages about a bundle. Warnings are always shown,
+// the log only in verbose mode.
+type Output interface {
+	Printf(format string, args ...interface{})
+	Logf(format string, args ...interface{})
+}
+
+// stdOutput prints messages right away, for bundles loaded without an Output.
+type stdOutput struct{}
+
+func (this stdOutput) Printf(format string, args ...interface{}) {
+	fmt.Printf(format, args...)
+}
+
+func (this stdOutput) Logf(format string, args ...interface{}) {
+	log.Printf(format, args...)
+}
+
 type Bundle struct {
 	Metadata     *common.Axe_v2
 	InputDirPath string
+
+	// Where warnings and log messages about this bundle go.
+	Out Output
+
+	// If set, CreatePackage signs the axe and writes the signature to Signature
+	// and to a .sig file next to the axe.
+	SigningKey ed25519.PrivateKey
+	Signature  string
+
+	// The hex SHA-256 digest of the axe, set by CreatePackage.
+	Sha256 string
+
+	// If set, CreatePackage writes byte-identical axes for identical sources:
+	// the timestamp comes from SOURCE_DATE_EPOCH, and zip entries are sorted
+	// and have fixed modification times and permissions.
+	Reproducible bool
+
+	expanded bool //whether expandManifest ran
 }
 
-func LoadBundle(inputDirPath string) (*Bundle, error) {
+// SourceDateEpoch returns the timestamp to use for reproducible builds, from
+// the SOURCE_DATE_EPOCH environment variable.
+func SourceDateEpoch() (int64, error) {
+	value := os.Getenv("SOURCE_DATE_EPOCH")
+	if value == "" {
+		return 0, fmt.Errorf("Cannot build reproducibly, SOURCE_DATE_EPOCH is not set.")
+	}
+	epoch, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || epoch < 0 {
+		return 0, fmt.Errorf("Cannot build reproducibly, bad SOURCE_DATE_EPOCH %v.", value)
+	}
+	return epoch, nil
+}
+
+// ParseMetadata unmarshals the contents of a metadata file, converting it from
+// the deprecated v1 format if needed.
+func ParseMetadata(metadataBytes []byte, metadataPath string) (*common.Axe_v2, bool, error) {
+	if common.IsAxe_v1(metadataBytes) {
+		v1 := new(common.Axe_v1)
+		if err := json.Unmarshal(metadataBytes, v1); err != nil {
+			return nil, true, fmt.Errorf("Cannot unmarshal v1 metadata file %v. JSON error: %v.",
+				metadataPath, err.Error())
+		}
+		return common.Axe_v1toV2(v1), true, nil
+	}
+
+	metadata := new(common.Axe_v2)
+	if err := json.Unmarshal(metadataBytes, metadata); err != nil {
+		return nil, false, fmt.Errorf("Cannot unmarshal metadata file %v. JSON error: %v.",
+			metadataPath, err.Error())
+	}
+	return metadata, false, nil
+}
+
+// LoadBundle reads and validates the metadata of the bundle in inputDirPath.
+// Messages go to out, or are printed right away if it is nil.
+func LoadBundle(inputDirPath string, out Output) (*Bundle, error) {
 	b := new(Bundle)
 	b.InputDirPath = inputDirPath
+	b.Out = out
+	if b.Out == nil {
+		b.Out = stdOutput{}
+	}
 
 	metadataPath := path.Join(inputDirPath, metadataRelPath)
 
@@ -63,70 +145,175 @@ func LoadBundle(inputDirPath string) (*Bundle, error) {
 		return nil, err
 	}
 
-	metadata := new(common.Axe_v2)
-	err = json.Unmarshal(metadataBytes, metadata)
-
+	metadata, isV1, err := ParseMetadata(metadataBytes, metadataPath)
 	if err != nil {
-		return nil, fmt.Errorf("Cannot unmarshal metadata file %v. JSON error: %v.",
-			metadataPath, err.Error())
+		return nil, err
+	}
+	if isV1 {
+		b.Out.Printf("Warning: metadata for %v is in the deprecated v1 format, see makeaxe --migrate.\n", metadata.PluginName)
 	}
 
-	if !common.Axe_v2check(metadata) {
-		return nil, fmt.Errorf("Bad or incomplete metadata in file %v.", metadataPath)
+	// binarySignature is filled in by CreatePackage, so it can't be required yet.
+	if problems := common.Axe_v2check(metadata).Without("binarySignature"); len(problems) != 0 {
+		return nil, &common.MetadataError{Path: metadataPath, Problems: problems}
 	}
 
 	// mangle a bit for backwards compatibility with v1 metadata.json
 	if metadata.Author != "" || metadata.Email != "" {
-		fmt.Printf("Warning: author and email fields for %v are deprecated.\n", metadata.PluginName)
+		b.Out.Printf("Warning: author and email fields for %v are deprecated.\n", metadata.PluginName)
 		if len(metadata.Authors) == 0 {
-			metadata.Authors = append(metadata.Authors, struct {
-				Name  string `json:"name"`
-				Email string `json:"email"`
-			}{metadata.Author, metadata.Email})
+			metadata.Authors = append(metadata.Authors, common.Author{Name: metadata.Author, Email: metadata.Email})
 		}
 	}
 
 	if metadata.License == "" {
-		fmt.Printf("Warning: license field is empty for %v.\n", metadata.PluginName)
+		b.Out.Printf("Warning: license field is empty for %v.\n", metadata.PluginName)
 	}
 
 	// Bundle version to distinguish one bundle format from another.
-	metadata.BundleVersion = bundleVersion
+	metadata.BundleVersion = BundleVersion
 
 	b.Metadata = metadata
 	return b, nil
 }
 
+// manifestFiles returns the paths, relative to the bundle directory or to the
+// root of the axe archive, of all the files listed in the manifest and binaries.
+func manifestFiles(metadata *common.Axe_v2) []string {
+	files := []string{}
+	if m := metadata.Manifest; m != nil {
+		if m.Main != "" {
+			files = append(files, path.Join("content", m.Main))
+		}
+		for _, s := range m.Scripts {
+			files = append(files, path.Join("content", s))
+		}
+		if m.Icon != "" {
+			files = append(files, path.Join("content", m.Icon))
+		}
+		for _, s := range m.Resources {
+			files = append(files, path.Join("content", s))
+		}
+	}
+	for _, b := range metadata.Binaries {
+		files = append(files, path.Join("content", b.Path))
+	}
+	return files
+}
+
+// signBinaries fills in the digests of the native libraries of a binary
+// resolver, and signs them into binarySignature.
+func (this *Bundle) signBinaries() error {
+	if this.SigningKey == nil {
+		return fmt.Errorf("Binary resolver %v must be signed, use --sign.", this.Metadata.PluginName)
+	}
+
+	for i := range this.Metadata.Binaries {
+		b := &this.Metadata.Binaries[i]
+		sum, err := util.Sha256sum(path.Join(this.InputDirPath, "content", b.Path))
+		if err != nil {
+			return err
+		}
+		b.Sha256 = sum
+	}
+	this.Metadata.BinarySignature = signing.Sign(this.SigningKey, common.BinarySigningData(this.Metadata))
+	return nil
+}
+
+// baseName returns the name of the axe file, without extension.
+func (this *Bundle) baseName() string {
+	if this.Metadata.AxeId != "" {
+		return this.Metadata.PluginName + "-" + this.Metadata.AxeId
+	}
+	return this.Metadata.PluginName + "-" + this.Metadata.Version
+}
+
+// OutputFileName returns the name of the axe file CreatePackage writes.
+func (this *Bundle) OutputFileName() string {
+	return this.baseName() + ".axe"
+}
+
+// InputHash returns a hex SHA-256 digest of the metadata file, of all the
+// files listed in the manifest, after expanding patterns, and of the build
+// options that change the axe, to tell whether a bundle changed since it was
+// last built.
+func (this *Bundle) InputHash(release bool) (string, error) {
+	if err := this.expandManifest(); err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "release=%v\x00reproducible=%v\x00", release, this.Reproducible)
+	if this.Reproducible {
+		epoch, err := SourceDateEpoch()
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "epoch=%v\x00", epoch)
+	}
+	if this.SigningKey != nil {
+		fmt.Fprintf(h, "key=%v\x00", signing.EncodePublicKey(signing.PublicKey(this.SigningKey)))
+	}
+	for _, fileName := range append([]string{metadataRelPath}, manifestFiles(this.Metadata)...) {
+		body, err := ioutil.ReadFile(path.Join(this.InputDirPath, fileName))
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%v\x00%v\x00", fileName, len(body))
+		h.Write(body)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// Check does everything CreatePackage does before writing the axe: it expands
+// the manifest, signs binaries, validates the metadata and makes sure all the
+// files to package are there. It writes nothing.
+func (this *Bundle) Check() error {
+	if err := this.expandManifest(); err != nil {
+		return err
+	}
+	if this.Metadata.Type == "resolver/binary" {
+		if err := this.signBinaries(); err != nil {
+			return err
+		}
+	}
+	if problems := common.Axe_v2check(this.Metadata); len(problems) != 0 {
+		return &common.MetadataError{Path: path.Join(this.InputDirPath, metadataRelPath), Problems: problems}
+	}
+	for _, fileName := range manifestFiles(this.Metadata) {
+		if ex, err := util.ExistsFile(path.Join(this.InputDirPath, fileName)); !ex || err != nil {
+			return fmt.Errorf("Cannot find manifest entry %v in %v.", fileName, this.InputDirPath)
+		}
+	}
+	return nil
+}
+
 func (this *Bundle) CreatePackage(outputDirPath string, release bool, force bool) (string, error) {
 	metadata := this.Metadata
 	pluginName := metadata.PluginName
 	version := metadata.Version
 
-	var (
-		outputFileName string
-		sumFileName    string
-	)
-
-	if metadata.AxeId != "" {
-		outputFileName = pluginName + "-" + metadata.AxeId + ".axe"
-		sumFileName = pluginName + "-" + metadata.AxeId + ".md5"
-	} else {
-		outputFileName = pluginName + "-" + version + ".axe"
-		sumFileName = pluginName + "-" + version + ".md5"
-	}
+	baseName := this.baseName()
+	outputFileName := baseName + ".axe"
+	sumFileName := baseName + ".md5"
+	sigFileName := baseName + ".sig"
 	outputFilePath := path.Join(outputDirPath, outputFileName)
 
 	ex, err := util.ExistsFile(outputFilePath)
 	if !force && (ex || err != nil) { //if we don't force, and the target either exists or we're not sure
-		log.Printf("* %v already exists, skipping.\n", outputFileName)
+		this.Out.Logf("* %v already exists, skipping.\n", outputFileName)
 		return outputFilePath, fmt.Errorf("Axe file %v already exists, skipping.", outputFileName)
 	}
 
 	// Let's add some stuff to the metadata file, this is information that's much
 	// easier to fill in automatically now than manually whenever.
-	//   * Timestamp of right now i.e. packaging time.
+	//   * Timestamp of right now i.e. packaging time, or SOURCE_DATE_EPOCH.
 	//   * Git revision because it makes sense, especially during development.
 	now := time.Now().Unix()
+	if this.Reproducible {
+		if now, err = SourceDateEpoch(); err != nil {
+			return "", err
+		}
+	}
 	metadata.Timestamp = &now
 	if !release {
 		gitCmd := exec.Command("git", "rev-parse", "--short", "HEAD")
@@ -135,29 +322,24 @@ func (this *Bundle) CreatePackage(outputDirPath string, release bool, force bool
 		if err == nil { //we are in a git repo
 			metadata.Revision = strings.TrimSpace(string(revision))
 		} else {
-			log.Printf("Warning: cannot get revision hash for %v-%v.\n", pluginName, version)
+			this.Out.Logf("Warning: cannot get revision hash for %v-%v.\n", pluginName, version)
 		}
 	}
+	if err := this.Check(); err != nil {
+		return "", err
+	}
 
 	metadataToWrite, err := json.MarshalIndent(metadata, "", "  ")
 	if err != nil {
 		return "", err
 	}
 
-	// Let's do some zipping according to the manifest.
-	filesToZip := []string{}
-	m := metadata.Manifest
-	filesToZip = append(filesToZip, path.Join("content", m.Main))
-	if m.Scripts != nil {
-		for _, s := range m.Scripts {
-			filesToZip = append(filesToZip, path.Join("content", s))
-		}
-	}
-	filesToZip = append(filesToZip, path.Join("content", m.Icon))
-	if m.Resources != nil {
-		for _, s := range m.Resources {
-			filesToZip = append(filesToZip, path.Join("content", s))
-		}
+	// Let's do some zipping according to the manifest. Patterns may overlap,
+	// e.g. scripts *.js also matches main, but every file goes in only once.
+	// JSON keys are always in struct order, but entries must be sorted too.
+	filesToZip := unique(manifestFiles(metadata))
+	if this.Reproducible {
+		sort.Strings(filesToZip)
 	}
 
 	ex, err = util.ExistsFile(outputFilePath)
@@ -176,7 +358,7 @@ func (this *Bundle) CreatePackage(outputDirPath string, release bool, force bool
 	z := zip.NewWriter(f)
 	defer z.Close()
 	for _, fileName := range filesToZip {
-		currentFile, err := z.Create(fileName)
+		currentFile, err := this.createEntry(z, fileName, now)
 		if err != nil {
 			return "", err
 		}
@@ -189,7 +371,7 @@ func (this *Bundle) CreatePackage(outputDirPath string, release bool, force bool
 			return "", err
 		}
 	}
-	currentFile, err := z.Create(metadataRelPath)
+	currentFile, err := this.createEntry(z, metadataRelPath, now)
 	if err != nil {
 		return "", err
 	}
@@ -201,11 +383,56 @@ func (this *Bundle) CreatePackage(outputDirPath string, release bool, force bool
 
 	sumValue, err := util.Md5sum(outputFilePath)
 	if err != nil {
-		log.Printf("Warning: could not create MD5 hash file for %v.\n", outputFileName)
+		this.Out.Logf("Warning: could not create MD5 hash file for %v.\n", outputFileName)
 	}
 	sumValue += "\t" + outputFileName
 	sumFilePath := path.Join(outputDirPath, sumFileName)
 	err = ioutil.WriteFile(sumFilePath, []byte(sumValue), 0644)
 
+	this.Sha256, err = util.Sha256sum(outputFilePath)
+	if err != nil {
+		return "", err
+	}
+
+	if this.SigningKey != nil {
+		body, err := ioutil.ReadFile(outputFilePath)
+		if err != nil {
+			return "", err
+		}
+		this.Signature = signing.Sign(this.SigningKey, body)
+		err = ioutil.WriteFile(path.Join(outputDirPath, sigFileName), []byte(this.Signature+"\n"), 0644)
+		if err != nil {
+			return "", err
+		}
+	}
+
 	return outputFilePath, nil
 }
+
+// createEntry adds a file to the axe archive. Reproducible entries get the
+// given modification time and fixed permissions.
+func (this *Bundle) createEntry(z *zip.Writer, fileName string, modified int64) (io.Writer, error) {
+	if !this.Reproducible {
+		return z.Create(fileName)
+	}
+	header := &zip.FileHeader{
+		Name:     fileName,
+		Method:   zip.Deflate,
+		Modified: time.Unix(modified, 0).UTC(),
+	}
+	header.SetMode(0644)
+	return z.CreateHeader(header)
+}
+
+// unique returns list without duplicates, in the order of first appearance.
+func unique(list []string) []string {
+	result := []string{}
+	seen := map[string]bool{}
+	for _, s := range list {
+		if !seen[s] {
+			seen[s] = true
+			result = append(result, s)
+		}
+	}
+	return result
+}
@@ -0,0 +1,189 @@
+/* === This file is part of Relaxe - <https://github.com/teo/relaxe> ===
+ *
+ *   Copyright 2013, Teo Mrnjavac <teo@kde.org>
+ *
+ *   Relaxe is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   Relaxe is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with Relaxe. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package bundle
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const ignoreFileName = ".axeignore"
+
+// hasGlob returns whether a manifest entry is a pattern rather than a path.
+func hasGlob(entry string) bool {
+	return strings.ContainsAny(entry, "*?[")
+}
+
+// matchGlob matches a slash-separated path against a pattern with the syntax of
+// path.Match, where a ** segment also matches any number of directories.
+func matchGlob(pattern string, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern []string, name []string) bool {
+	if len(pattern) == 0 {
+		return len(name) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(name); i++ {
+			if matchSegments(pattern[1:], name[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(name) == 0 {
+		return false
+	}
+	if ok, err := path.Match(pattern[0], name[0]); !ok || err != nil {
+		return false
+	}
+	return matchSegments(pattern[1:], name[1:])
+}
+
+// loadIgnorePatterns reads the .axeignore file of a bundle, if any: one
+// pattern per line, relative to the content directory, # starts a comment.
+// A pattern without a slash matches a file name in any directory.
+func loadIgnorePatterns(inputDirPath string) ([]string, error) {
+	f, err := os.Open(path.Join(inputDirPath, ignoreFileName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	patterns := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimSuffix(strings.TrimPrefix(line, "/"), "/")
+		if !strings.Contains(line, "/") {
+			line = "**/" + line
+		}
+		patterns = append(patterns, line, line+"/**") //also ignore everything in matching directories
+	}
+	return patterns, scanner.Err()
+}
+
+// contentFiles returns the paths, relative to the content directory, of all the
+// files in it except metadata.json and the ignored ones, sorted.
+func contentFiles(inputDirPath string, ignored []string) ([]string, error) {
+	contentPath := path.Join(inputDirPath, "content")
+	files := []string{}
+	err := filepath.Walk(contentPath, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(contentPath, filePath)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == path.Base(metadataRelPath) {
+			return nil
+		}
+		for _, pattern := range ignored {
+			if matchGlob(pattern, rel) {
+				return nil
+			}
+		}
+		files = append(files, rel)
+		return nil
+	})
+	sort.Strings(files)
+	return files, err
+}
+
+// expandManifest replaces the glob patterns in manifest scripts and resources
+// with the files they match, leaving out those in .axeignore. It warns about
+// patterns that match nothing and about files in the content directory that
+// the manifest doesn't cover. It only does the work once.
+func (this *Bundle) expandManifest() error {
+	manifest := this.Metadata.Manifest
+	if this.expanded || manifest == nil {
+		return nil
+	}
+
+	ignored, err := loadIgnorePatterns(this.InputDirPath)
+	if err != nil {
+		return fmt.Errorf("Cannot read %v for %v. %v", ignoreFileName, this.Metadata.PluginName, err.Error())
+	}
+	files, err := contentFiles(this.InputDirPath, ignored)
+	if err != nil {
+		return fmt.Errorf("Cannot list content files for %v. %v", this.Metadata.PluginName, err.Error())
+	}
+
+	expand := func(entries []string) []string {
+		result := []string{}
+		listed := map[string]bool{}
+		add := func(entry string) {
+			if !listed[entry] {
+				listed[entry] = true
+				result = append(result, entry)
+			}
+		}
+		for _, entry := range entries {
+			if !hasGlob(entry) {
+				add(entry)
+				continue
+			}
+			matched := false
+			for _, f := range files {
+				if matchGlob(entry, f) {
+					add(f)
+					matched = true
+				}
+			}
+			if !matched {
+				this.Out.Printf("Warning: manifest pattern %v for %v matches no files.\n", entry, this.Metadata.PluginName)
+			}
+		}
+		return result
+	}
+	expandedManifest := *manifest
+	expandedManifest.Scripts = expand(manifest.Scripts)
+	expandedManifest.Resources = expand(manifest.Resources)
+	this.Metadata.Manifest = &expandedManifest
+	this.expanded = true
+
+	covered := map[string]bool{}
+	for _, fileName := range manifestFiles(this.Metadata) {
+		covered[strings.TrimPrefix(fileName, "content/")] = true
+	}
+	for _, f := range files {
+		if !covered[f] {
+			this.Out.Printf("Warning: content/%v in %v is not in the manifest, add it or list it in %v.\n",
+				f, this.Metadata.PluginName, ignoreFileName)
+		}
+	}
+	return nil
+}
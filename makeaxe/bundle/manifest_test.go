@@ -0,0 +1,169 @@
+/* === This file is part of Relaxe - <https://github.com/teo/relaxe> ===
+ *
+ *   Copyright 2013, Teo Mrnjavac <teo@kde.org>
+ *
+ *   Relaxe is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   Relaxe is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with Relaxe. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package bundle
+
+import (
+	"archive/zip"
+	"fmt"
+	"github.com/teo/relaxe/common"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{"*.js", "main.js", true},
+		{"*.js", "lib/a.js", false},
+		{"lib/*.js", "lib/a.js", true},
+		{"lib/?.js", "lib/a.js", true},
+		{"lib/[ab].js", "lib/c.js", false},
+		{"**/*.js", "main.js", true},
+		{"**/*.js", "lib/deep/b.js", true},
+		{"lib/**", "lib/deep/b.js", true},
+		{"lib/**", "img/icon.png", false},
+		{"lib/**/b.js", "lib/b.js", true},
+		{"lib/**/b.js", "lib/deep/er/b.js", true},
+		{"lib/**/b.js", "lib/deep/c.js", false},
+		{"[", "[", false},
+	}
+	for _, test := range tests {
+		if got := matchGlob(test.pattern, test.name); got != test.want {
+			t.Errorf("matchGlob(%q, %q) = %v, want %v", test.pattern, test.name, got, test.want)
+		}
+	}
+}
+
+// testOutput records the messages about a bundle.
+type testOutput struct {
+	messages []string
+}
+
+func (this *testOutput) Printf(format string, args ...interface{}) {
+	this.messages = append(this.messages, fmt.Sprintf(format, args...))
+}
+
+func (this *testOutput) Logf(format string, args ...interface{}) {}
+
+// writeBundle creates a bundle directory with the given files, and metadata
+// with the given manifest scripts and resources.
+func writeBundle(t *testing.T, files map[string]string, scripts []string, resources []string) *Bundle {
+	dir := t.TempDir()
+	for name, contents := range files {
+		filePath := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filePath, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &Bundle{
+		Metadata: &common.Axe_v2{
+			PluginName:  "foo",
+			Name:        "Foo",
+			Version:     "1.0.0",
+			Description: "Finds foo.",
+			Platform:    "any",
+			Type:        "resolver/javascript",
+			Manifest:    &common.Manifest{Main: "main.js", Icon: "img/icon.png", Scripts: scripts, Resources: resources},
+		},
+		InputDirPath: dir,
+		Out:          &testOutput{},
+	}
+}
+
+func TestExpandManifest(t *testing.T) {
+	files := map[string]string{
+		"content/main.js":        "main",
+		"content/lib/a.js":       "a",
+		"content/lib/deep/b.js":  "b",
+		"content/img/icon.png":   "icon",
+		"content/img/icon.psd":   "huge",
+		"content/notes/todo.txt": "later",
+		"content/extra.txt":      "forgotten",
+		".axeignore":             "# sources of images\n*.psd\n\n/notes/\n",
+	}
+	b := writeBundle(t, files, []string{"**/*.js", "lib/a.js"}, []string{"img/*", "sounds/*"})
+	if err := b.expandManifest(); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"lib/a.js", "lib/deep/b.js", "main.js"}; !reflect.DeepEqual(b.Metadata.Manifest.Scripts, want) {
+		t.Errorf("scripts = %v, want %v", b.Metadata.Manifest.Scripts, want)
+	}
+	if want := []string{"img/icon.png"}; !reflect.DeepEqual(b.Metadata.Manifest.Resources, want) {
+		t.Errorf("resources = %v, want %v", b.Metadata.Manifest.Resources, want)
+	}
+
+	messages := strings.Join(b.Out.(*testOutput).messages, "")
+	for _, warning := range []string{"pattern sounds/* for foo matches no files", "content/extra.txt in foo is not in the manifest"} {
+		if !strings.Contains(messages, warning) {
+			t.Errorf("no warning %q in:\n%v", warning, messages)
+		}
+	}
+	for _, ignored := range []string{"icon.psd", "todo.txt"} {
+		if strings.Contains(messages, ignored) {
+			t.Errorf("warning about ignored file %v in:\n%v", ignored, messages)
+		}
+	}
+}
+
+func TestCreatePackageEntries(t *testing.T) {
+	files := map[string]string{
+		"content/main.js":      "main",
+		"content/lib.js":       "lib",
+		"content/img/icon.png": "icon",
+	}
+	for _, reproducible := range []bool{false, true} {
+		b := writeBundle(t, files, []string{"*.js"}, []string{"img/*"})
+		b.Reproducible = reproducible
+		os.Setenv("SOURCE_DATE_EPOCH", "1380000000")
+
+		outputFilePath, err := b.CreatePackage(t.TempDir(), true, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		z, err := zip.OpenReader(outputFilePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names := []string{}
+		for _, f := range z.File {
+			names = append(names, f.Name)
+		}
+		z.Close()
+
+		// main.js is both main and matched by *.js, but is only packaged once
+		want := []string{"content/main.js", "content/lib.js", "content/img/icon.png", "content/metadata.json"}
+		if reproducible {
+			want = []string{"content/img/icon.png", "content/lib.js", "content/main.js", "content/metadata.json"}
+		}
+		if !reflect.DeepEqual(names, want) {
+			t.Errorf("reproducible %v: entries = %v, want %v", reproducible, names, want)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+/* === This file is part of Relaxe - <https://github.com/teo/relaxe> ===
+ *
+ *   Copyright 2013, Teo Mrnjavac <teo@kde.org>
+ *
+ *   Relaxe is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   Relaxe is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with Relaxe. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package bundle
+
+import (
+	"archive/zip"
+	"fmt"
+	"github.com/teo/relaxe/common"
+	"github.com/teo/relaxe/common/util"
+	"io/ioutil"
+	"path"
+	"strings"
+)
+
+// Package is an axe archive opened for reading.
+type Package struct {
+	Path     string
+	Metadata *common.Axe_v2
+	z        *zip.ReadCloser
+}
+
+func OpenPackage(packagePath string) (*Package, error) {
+	z, err := zip.OpenReader(packagePath)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot open axe %v. %v", packagePath, err.Error())
+	}
+
+	metadata, err := common.ReadPackageMetadata(&z.Reader)
+	if err != nil {
+		z.Close()
+		return nil, err
+	}
+
+	this := new(Package)
+	this.Path = packagePath
+	this.Metadata = metadata
+	this.z = z
+	return this, nil
+}
+
+func (this *Package) Files() []*zip.File {
+	return this.z.File
+}
+
+func (this *Package) Close() {
+	this.z.Close()
+}
+
+// Verify checks the metadata, that every manifest entry is in the archive, and
+// that the archive matches its MD5 sidecar. It returns all the problems found.
+func (this *Package) Verify() []string {
+	problems := []string{}
+
+	for _, p := range common.Axe_v2check(this.Metadata) {
+		problems = append(problems, "Bad metadata, "+p.String())
+	}
+
+	present := map[string]bool{}
+	for _, f := range this.z.File {
+		present[f.Name] = true
+	}
+	for _, fileName := range manifestFiles(this.Metadata) {
+		if !present[fileName] {
+			problems = append(problems, fmt.Sprintf("Manifest entry %v is missing from the archive.", fileName))
+		}
+	}
+
+	sumFilePath := strings.TrimSuffix(this.Path, ".axe") + ".md5"
+	sumBytes, err := ioutil.ReadFile(sumFilePath)
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("Cannot read checksum file %v.", sumFilePath))
+		return problems
+	}
+	expected := strings.Fields(string(sumBytes))
+	actual, err := util.Md5sum(this.Path)
+	if err != nil {
+		problems = append(problems, err.Error())
+	} else if len(expected) == 0 || expected[0] != actual {
+		problems = append(problems, fmt.Sprintf("Checksum mismatch, %v does not match %v.", path.Base(this.Path), path.Base(sumFilePath)))
+	}
+
+	return problems
+}
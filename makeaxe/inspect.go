@@ -0,0 +1,71 @@
+/* === This file is part of Relaxe - <https://github.com/teo/relaxe> ===
+ *
+ *   Copyright 2013, Teo Mrnjavac <teo@kde.org>
+ *
+ *   Relaxe is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   Relaxe is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with Relaxe. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/teo/relaxe/makeaxe/bundle"
+	"strings"
+)
+
+func inspectPackage(packagePath string) (string, error) {
+	p, err := bundle.OpenPackage(packagePath)
+	if err != nil {
+		return "", err
+	}
+	defer p.Close()
+
+	mrshld, _ := json.MarshalIndent(p.Metadata, "", "  ")
+	text := fmt.Sprintf("*** %v ***\n\nMetadata:\n%v\n", packagePath, string(mrshld))
+
+	if m := p.Metadata.Manifest; m != nil {
+		text += fmt.Sprintf("Manifest:\n"+
+			"    main:      %v\n"+
+			"    icon:      %v\n"+
+			"    scripts:   %v\n"+
+			"    resources: %v\n",
+			m.Main, m.Icon, strings.Join(m.Scripts, ", "), strings.Join(m.Resources, ", "))
+	} else {
+		text += "Manifest: none\n"
+	}
+
+	var total uint64
+	text += fmt.Sprintf("Files: %v\n", len(p.Files()))
+	for _, f := range p.Files() {
+		text += fmt.Sprintf("    %10d  %v\n", f.UncompressedSize64, f.Name)
+		total += f.UncompressedSize64
+	}
+	text += fmt.Sprintf("    %10d  total\n", total)
+	return text, nil
+}
+
+func verifyPackage(packagePath string) (string, bool) {
+	p, err := bundle.OpenPackage(packagePath)
+	if err != nil {
+		return fmt.Sprintf("%v: FAILED\n    * %v\n", packagePath, err.Error()), false
+	}
+	defer p.Close()
+
+	problems := p.Verify()
+	if len(problems) == 0 {
+		return fmt.Sprintf("%v: OK\n", packagePath), true
+	}
+	return fmt.Sprintf("%v: FAILED\n    * %v\n", packagePath, strings.Join(problems, "\n    * ")), false
+}
@@ -0,0 +1,150 @@
+/* === This file is part of Relaxe - <https://github.com/teo/relaxe> ===
+ *
+ *   Copyright 2013, Teo Mrnjavac <teo@kde.org>
+ *
+ *   Relaxe is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   Relaxe is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with Relaxe. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"fmt"
+	"github.com/teo/relaxe/makeaxe/bundle"
+	"log"
+	"sync"
+)
+
+type buildStatus int
+
+const (
+	statusBuilt buildStatus = iota
+	statusError
+	statusSkipped
+)
+
+func (this buildStatus) String() string {
+	return [...]string{"built", "error", "skipped"}[this]
+}
+
+// buildResult is the outcome of building one bundle.
+type buildResult struct {
+	directory  string //set by buildEach
+	status     buildStatus
+	entry      string //shown in the summary, if built
+	reason     string
+	bundle     *bundle.Bundle //nil if it could not be loaded
+	outputPath string
+	output     *buildOutput //set by buildEach
+}
+
+// buildOutput collects the warnings and log messages of one build, so that
+// buildEach can print them in input order, whatever the scheduling.
+type buildOutput struct {
+	messages []buildMessage
+}
+
+type buildMessage struct {
+	text    string
+	verbose bool //only shown with --verbose, like log output
+}
+
+// Printf adds a message that is always shown.
+func (this *buildOutput) Printf(format string, args ...interface{}) {
+	this.messages = append(this.messages, buildMessage{fmt.Sprintf(format, args...), false})
+}
+
+// Logf adds a message that is only shown with --verbose.
+func (this *buildOutput) Logf(format string, args ...interface{}) {
+	this.messages = append(this.messages, buildMessage{fmt.Sprintf(format, args...), true})
+}
+
+func (this *buildOutput) print() {
+	for _, m := range this.messages {
+		if m.verbose {
+			log.Print(m.text)
+		} else {
+			fmt.Print(m.text)
+		}
+	}
+}
+
+func builtResult(b *bundle.Bundle, outputPath string, entry string) buildResult {
+	return buildResult{status: statusBuilt, entry: entry, bundle: b, outputPath: outputPath}
+}
+
+func skippedResult(b *bundle.Bundle, reason string) buildResult {
+	return buildResult{status: statusSkipped, reason: reason, bundle: b}
+}
+
+func errorResult(b *bundle.Bundle, reason string) buildResult {
+	return buildResult{status: statusError, reason: reason, bundle: b}
+}
+
+// buildEach calls build for every directory in inputList on up to jobs workers,
+// and returns the results in input order, whatever the scheduling. The output
+// of each build is printed in input order too, as soon as it is done.
+func buildEach(inputList []string, build func(inputDirPath string, out *buildOutput) buildResult) []buildResult {
+	results := make([]buildResult, len(inputList))
+	done := make([]chan bool, len(inputList))
+	for i := range done {
+		done[i] = make(chan bool)
+	}
+	indices := make(chan int)
+
+	for w := 0; w < jobs && w < len(inputList); w++ {
+		go func() {
+			for i := range indices {
+				out := new(buildOutput)
+				results[i] = build(inputList[i], out)
+				results[i].directory = inputList[i]
+				results[i].output = out
+				close(done[i])
+			}
+		}()
+	}
+	go func() {
+		for i := range inputList {
+			indices <- i
+		}
+		close(indices)
+	}()
+
+	for i := range inputList {
+		<-done[i]
+		results[i].output.print()
+	}
+	return results
+}
+
+// claims keeps track of the axes built in this run, so that two bundles with
+// the same name and version are never written at the same time.
+type claims struct {
+	mutex sync.Mutex
+	names map[string]bool
+}
+
+func newClaims() *claims {
+	return &claims{names: map[string]bool{}}
+}
+
+// claim returns false if name was already claimed.
+func (this *claims) claim(name string) bool {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if this.names[name] {
+		return false
+	}
+	this.names[name] = true
+	return true
+}
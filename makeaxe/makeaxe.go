@@ -19,10 +19,13 @@
 package main
 
 import (
+	"crypto/ed25519"
 	"flag"
 	"fmt"
 	"github.com/teo/relaxe/common"
+	"github.com/teo/relaxe/common/signing"
 	"github.com/teo/relaxe/common/util"
+	"github.com/teo/relaxe/makeaxe/bundle"
 	"io/ioutil"
 	"log"
 	"os"
@@ -42,11 +45,28 @@ var (
 	help    bool
 	verbose bool
 	relaxe  bool
+	token   string
+	channel string
+	inspect bool
+	verify  bool
+	migrate bool
+	jobs    int
+
+	reproducible bool
+	dryRun       bool
+	reportPath   string
+	junitPath    string
+
+	signKeyPath   string
+	genKeyPath    string
+	exportKeyPath string
+	signingKey    ed25519.PrivateKey
 )
 
 func usage() {
 	fmt.Printf("*** %v %v - %v ***\n\n", programName, programVersion, programDescription)
 	fmt.Println("Usage: ./makeaxe [OPTIONS] SOURCE [DESTINATION|CONFIG]")
+	fmt.Println("       ./makeaxe --inspect|--verify AXE...")
 	fmt.Println("OPTIONS")
 	flag.VisitAll(func(f *flag.Flag) {
 		if len(f.Name) < 2 {
@@ -62,7 +82,8 @@ func usage() {
 	fmt.Println("\tDESTINATION\tOptional, the path of the directory where newly built bundles (axes) should be placed. " +
 		"\n\t\t\tIf unset, it is the same as the source directory. Not used when publishing to Relaxe (--relaxe, -x).")
 
-	fmt.Println("\tCONFIG\t\tOnly when publishing to Relaxe (--relaxe, -x), the path of the Relaxe configuration file.")
+	fmt.Println("\tCONFIG\t\tOnly when publishing to Relaxe (--relaxe, -x), the path of the Relaxe configuration file, " +
+		"\n\t\t\tor the URL of a Relaxe server (e.g. https://relaxe.example.org), which requires --token.")
 }
 
 func die(message string) {
@@ -75,10 +96,23 @@ func init() {
 	const (
 		flagAllUsage     = "--all, -a\tbuild all the resolvers in the SOURCE path's subdirectories"
 		flagReleaseUsage = "--release, -r\tskip trying to add the git revision hash to a bundle"
-		flagForceUsage   = "--force, -f\tbuild a bundle and overwrite even if the destination directory already contains a bundle of the same name and version"
+		flagForceUsage   = "--force, -f\tbuild a bundle and overwrite even if the destination directory already contains an up to date bundle of the same name and version"
 		flagHelpUsage    = "--help, -h\tthis help message"
 		flagVerbose      = "--verbose, -v\tshow verbose output"
-		flagRelaxeUsage  = "--relaxe, -x\tpublish resolvers on a Relaxe instance with the given config file, implies --release and ignores --force and DESTINATION"
+		flagRelaxeUsage  = "--relaxe, -x\tpublish resolvers on a Relaxe instance with the given config file or server URL, implies --release and ignores --force and DESTINATION"
+		flagTokenUsage   = "--token, -t\tthe publisher token to authenticate with when publishing to a Relaxe server URL"
+		flagInspectUsage = "--inspect, -i\tprint the metadata, manifest and files of the given axe files"
+		flagVerifyUsage  = "--verify\tcheck the metadata, manifest and checksum of the given axe files"
+		flagMigrateUsage = "--migrate, -m\tconvert v1 metadata.json files in SOURCE to v2, showing a diff; only rewrites them with --force"
+		flagChannelUsage = "--channel, -c\tthe release channel to publish to on Relaxe: stable (default), beta or nightly"
+		flagJobsUsage    = "--jobs, -j N\tbuild up to N bundles at the same time (default 1)"
+		flagReproducible = "--reproducible\tbuild byte-identical axes from identical sources, using SOURCE_DATE_EPOCH as the timestamp"
+		flagDryRunUsage  = "--dry-run, -n\twith --relaxe, check which axes would be published, skipped or rejected without writing or publishing anything"
+		flagReportUsage  = "--report FILE\twrite a JSON report with the status, reason, output path, AxeId, version and checksum of every bundle"
+		flagJunitUsage   = "--junit FILE\twrite the same report as JUnit XML, with a test case for every bundle"
+		flagSignUsage    = "--sign, -k KEYFILE\tsign the axes with the given private key"
+		flagGenKeyUsage  = "--genkey KEYFILE\tgenerate a new signing key pair, write the private key to KEYFILE and print the public key"
+		flagExportUsage  = "--export-key KEYFILE\tprint the public key for the private key in KEYFILE, to add to the Relaxe configuration"
 	)
 	flag.BoolVar(&all, "all", false, flagAllUsage)
 	flag.BoolVar(&all, "a", false, flagAllUsage+" (shorthand)")
@@ -92,6 +126,26 @@ func init() {
 	flag.BoolVar(&verbose, "v", false, flagVerbose)
 	flag.BoolVar(&relaxe, "relaxe", false, flagRelaxeUsage)
 	flag.BoolVar(&relaxe, "x", false, flagRelaxeUsage)
+	flag.StringVar(&token, "token", "", flagTokenUsage)
+	flag.StringVar(&token, "t", "", flagTokenUsage)
+	flag.BoolVar(&inspect, "inspect", false, flagInspectUsage)
+	flag.BoolVar(&inspect, "i", false, flagInspectUsage)
+	flag.BoolVar(&verify, "verify", false, flagVerifyUsage)
+	flag.BoolVar(&migrate, "migrate", false, flagMigrateUsage)
+	flag.BoolVar(&migrate, "m", false, flagMigrateUsage)
+	flag.StringVar(&channel, "channel", "", flagChannelUsage)
+	flag.StringVar(&channel, "c", "", flagChannelUsage)
+	flag.IntVar(&jobs, "jobs", 1, flagJobsUsage)
+	flag.IntVar(&jobs, "j", 1, flagJobsUsage)
+	flag.BoolVar(&reproducible, "reproducible", false, flagReproducible)
+	flag.BoolVar(&dryRun, "dry-run", false, flagDryRunUsage)
+	flag.BoolVar(&dryRun, "n", false, flagDryRunUsage)
+	flag.StringVar(&reportPath, "report", "", flagReportUsage)
+	flag.StringVar(&junitPath, "junit", "", flagJunitUsage)
+	flag.StringVar(&signKeyPath, "sign", "", flagSignUsage)
+	flag.StringVar(&signKeyPath, "k", "", flagSignUsage)
+	flag.StringVar(&genKeyPath, "genkey", "", flagGenKeyUsage)
+	flag.StringVar(&exportKeyPath, "export-key", "", flagExportUsage)
 
 	flag.Usage = usage
 }
@@ -108,6 +162,82 @@ func main() {
 		log.SetOutput(ioutil.Discard)
 	}
 
+	// Key management modes, no building
+	if genKeyPath != "" {
+		if ex, err := util.ExistsFile(genKeyPath); ex || err != nil {
+			die("Error: key file " + genKeyPath + " already exists.")
+		}
+		pub, err := signing.GenerateKey(genKeyPath)
+		if err != nil {
+			die("Error: cannot generate key. Reason: " + err.Error())
+		}
+		fmt.Printf("Private key written to %v.\nPublic key: %v\n", genKeyPath, signing.EncodePublicKey(pub))
+		return
+	}
+	if exportKeyPath != "" {
+		key, err := signing.LoadPrivateKey(exportKeyPath)
+		if err != nil {
+			die("Error: " + err.Error())
+		}
+		fmt.Println(signing.EncodePublicKey(signing.PublicKey(key)))
+		return
+	}
+	if signKeyPath != "" {
+		var err error
+		signingKey, err = signing.LoadPrivateKey(signKeyPath)
+		if err != nil {
+			die("Error: " + err.Error())
+		}
+	}
+
+	// Axe file modes, no building
+	if inspect || verify {
+		if len(flag.Args()) == 0 {
+			die("Error: an axe file must be specified.")
+		}
+		ok := true
+		for _, packagePath := range flag.Args() {
+			var text string
+			if inspect {
+				var err error
+				text, err = inspectPackage(packagePath)
+				if err != nil {
+					fmt.Println(err.Error())
+					ok = false
+					continue
+				}
+			}
+			if verify {
+				verifyText, verified := verifyPackage(packagePath)
+				text += verifyText
+				ok = ok && verified
+			}
+			fmt.Print(text)
+		}
+		if !ok {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if channel != "" && (!relaxe || common.ChannelRank(channel) < 0) {
+		die("Error: bad release channel, or not publishing to Relaxe.")
+	}
+
+	if dryRun && !relaxe {
+		die("Error: dry runs are only for publishing to Relaxe.")
+	}
+
+	if reproducible {
+		if _, err := bundle.SourceDateEpoch(); err != nil {
+			die("Error: " + err.Error())
+		}
+	}
+
+	if jobs < 1 {
+		die("Error: the number of jobs must be at least 1.")
+	}
+
 	if len(flag.Args()) == 0 {
 		die("Error: a source directory must be specified.")
 	}
@@ -127,10 +257,21 @@ func main() {
 
 	inputList := preparePaths(inputPath)
 
-	var summary string
+	var (
+		summary string
+		results []buildResult
+	)
+
+	if migrate {
+		fmt.Print(migrateAll(inputList))
+		return
+	}
 
 	// Prepare output directory path and build
-	if relaxe {
+	if relaxe && len(flag.Args()) == 2 && isServerUrl(flag.Arg(1)) {
+		summary, results = buildToRemoteRelaxe(inputList, flag.Arg(1))
+
+	} else if relaxe {
 		if len(flag.Args()) != 2 {
 			die("Error: source or Relaxe configuration file path missing.")
 		}
@@ -147,7 +288,7 @@ func main() {
 			die(err.Error())
 		}
 
-		summary = buildToRelaxe(inputList, *config)
+		summary, results = buildToRelaxe(inputList, *config)
 
 	} else {
 		var outputPath string
@@ -164,8 +305,26 @@ func main() {
 			}
 		}
 
-		summary = buildToDirectory(inputList, outputPath)
+		summary, results = buildToDirectory(inputList, outputPath)
 	}
 
 	fmt.Printf(summary)
+
+	if reportPath != "" {
+		if err := writeJsonReport(reportPath, results); err != nil {
+			die("Error: cannot write report. Reason: " + err.Error())
+		}
+	}
+	if junitPath != "" {
+		if err := writeJunitReport(junitPath, results); err != nil {
+			die("Error: cannot write JUnit report. Reason: " + err.Error())
+		}
+	}
+
+	// Let scripts and CI tell a failed build from a successful one
+	for _, r := range results {
+		if r.status == statusError {
+			os.Exit(1)
+		}
+	}
 }
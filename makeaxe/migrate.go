@@ -0,0 +1,156 @@
+/* === This file is part of Relaxe - <https://github.com/teo/relaxe> ===
+ *
+ *   Copyright 2013, Teo Mrnjavac <teo@kde.org>
+ *
+ *   Relaxe is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   Relaxe is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with Relaxe. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/teo/relaxe/common"
+	"github.com/teo/relaxe/makeaxe/bundle"
+	"io/ioutil"
+	"path"
+	"strings"
+)
+
+// lineDiff returns a line by line diff of a and b, with unchanged lines
+// prefixed by two spaces, removed lines by "- " and added lines by "+ ".
+func lineDiff(a string, b string) string {
+	al := strings.Split(strings.TrimRight(a, "\n"), "\n")
+	bl := strings.Split(strings.TrimRight(b, "\n"), "\n")
+
+	// lcs[i][j] is the length of the longest common subsequence of al[i:] and bl[j:]
+	lcs := make([][]int, len(al)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(bl)+1)
+	}
+	for i := len(al) - 1; i >= 0; i-- {
+		for j := len(bl) - 1; j >= 0; j-- {
+			if al[i] == bl[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	diff := ""
+	i, j := 0, 0
+	for i < len(al) || j < len(bl) {
+		switch {
+		case i < len(al) && j < len(bl) && al[i] == bl[j]:
+			diff += "  " + al[i] + "\n"
+			i++
+			j++
+		case i < len(al) && (j == len(bl) || lcs[i+1][j] >= lcs[i][j+1]):
+			diff += "- " + al[i] + "\n"
+			i++
+		default:
+			diff += "+ " + bl[j] + "\n"
+			j++
+		}
+	}
+	return diff
+}
+
+// migrateBundle converts the v1 metadata file of a bundle to v2, and rewrites
+// it if write is set. It returns a preview of the changes.
+func migrateBundle(inputDirPath string, write bool) (string, bool, error) {
+	metadataPath := path.Join(inputDirPath, common.MetadataPath)
+	metadataBytes, err := ioutil.ReadFile(metadataPath)
+	if err != nil {
+		return "", false, err
+	}
+
+	if !common.IsAxe_v1(metadataBytes) {
+		return fmt.Sprintf("%v: already in v2 format, nothing to do.\n", metadataPath), false, nil
+	}
+
+	metadata, _, err := bundle.ParseMetadata(metadataBytes, metadataPath)
+	if err != nil {
+		return "", false, err
+	}
+	metadata.BundleVersion = bundle.BundleVersion
+	migratedBytes, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return "", false, err
+	}
+	migratedBytes = append(migratedBytes, '\n')
+
+	text := fmt.Sprintf("--- %v (v1)\n+++ %v (v2)\n%v", metadataPath, metadataPath,
+		lineDiff(string(metadataBytes), string(migratedBytes)))
+	if problems := common.Axe_v2check(metadata).Without("binarySignature"); len(problems) != 0 {
+		text += fmt.Sprintf("Metadata still needs fixing after migration:\n    * %v\n",
+			strings.Join(problems.Strings(), "\n    * "))
+	}
+
+	if write {
+		if err = ioutil.WriteFile(metadataPath, migratedBytes, 0644); err != nil {
+			return "", false, err
+		}
+	}
+	return text, true, nil
+}
+
+func migrateAll(inputList []string) string {
+	migrated := []string{}
+	errors := []string{}
+	skipped := []string{}
+
+	for _, inputDirPath := range inputList {
+		text, changed, err := migrateBundle(inputDirPath, force)
+		if err != nil {
+			fmt.Printf("Warning: could not migrate %v. %v\n", path.Base(inputDirPath), err.Error())
+			errors = append(errors, path.Base(inputDirPath))
+			continue
+		}
+		fmt.Print(text)
+		if changed {
+			migrated = append(migrated, path.Base(inputDirPath))
+		} else {
+			skipped = append(skipped, path.Base(inputDirPath))
+		}
+	}
+
+	summary := "*** makeaxe Summary ***\n\n"
+	if force {
+		summary += "Metadata files rewritten in place.\n"
+	} else {
+		summary += "Preview only, run again with --force to rewrite the metadata files.\n"
+	}
+	if len(migrated) == 0 {
+		summary += "No metadata files to migrate\n"
+	} else if force {
+		summary += fmt.Sprintf("Metadata files migrated: %v\n"+
+			"    * %v\n", len(migrated), strings.Join(migrated, "\n    * "))
+	} else {
+		summary += fmt.Sprintf("Metadata files that would migrate: %v\n"+
+			"    * %v\n", len(migrated), strings.Join(migrated, "\n    * "))
+	}
+	if len(errors) != 0 {
+		summary += fmt.Sprintf("Migration errors: %v\n"+
+			"    * %v\n", len(errors), strings.Join(errors, "\n    * "))
+	}
+	if len(skipped) != 0 {
+		summary += fmt.Sprintf("Already in v2 format: %v\n"+
+			"    * %v\n", len(skipped), strings.Join(skipped, "\n    * "))
+	}
+	return summary
+}
@@ -0,0 +1,136 @@
+/* === This file is part of Relaxe - <https://github.com/teo/relaxe> ===
+ *
+ *   Copyright 2013, Teo Mrnjavac <teo@kde.org>
+ *
+ *   Relaxe is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   Relaxe is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with Relaxe. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"github.com/teo/relaxe/common"
+	"github.com/teo/relaxe/makeaxe/bundle"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLineDiff(t *testing.T) {
+	tests := []struct {
+		a    string
+		b    string
+		want string
+	}{
+		{"a\nb\n", "a\nb\n", "  a\n  b\n"},
+		{"a\nb\nc\n", "a\nc\n", "  a\n- b\n  c\n"},
+		{"a\nc", "a\nb\nc", "  a\n+ b\n  c\n"},
+		{"a\nb\n", "a\nx\n", "  a\n- b\n+ x\n"},
+	}
+	for _, test := range tests {
+		if got := lineDiff(test.a, test.b); got != test.want {
+			t.Errorf("lineDiff(%q, %q) = %q, want %q", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+// v1Metadata is the metadata of a bundle in the v1 format.
+const v1Metadata = `{
+  "name": "Foo",
+  "pluginName": "foo",
+  "author": "Jane",
+  "email": "jane@example.org",
+  "description": "Finds foo.",
+  "platform": "any",
+  "tomahawkVersion": "0.7",
+  "type": "resolver/javascript",
+  "version": "1.2",
+  "manifest": {"main": "foo.js", "icon": "foo.png", "scripts": [], "resources": []}
+}
+`
+
+// writeV1Bundle creates a bundle with v1 metadata in dir, and returns the path
+// of its metadata file.
+func writeV1Bundle(t *testing.T, dir string) string {
+	metadataPath := filepath.Join(dir, common.MetadataPath)
+	if err := os.MkdirAll(filepath.Dir(metadataPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(metadataPath, []byte(v1Metadata), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return metadataPath
+}
+
+func TestMigrateBundle(t *testing.T) {
+	dir := t.TempDir()
+	metadataPath := writeV1Bundle(t, dir)
+
+	// Preview only
+	text, changed, err := migrateBundle(dir, false)
+	if err != nil || !changed {
+		t.Fatalf("migrateBundle() = %v, %v, want a change", changed, err)
+	}
+	for _, line := range []string{`-   "tomahawkVersion": "0.7",`, `+   "apiVersion": "0.7",`} {
+		if !strings.Contains(text, line) {
+			t.Errorf("migrateBundle() preview has no line %v:\n%v", line, text)
+		}
+	}
+	if data, _ := ioutil.ReadFile(metadataPath); string(data) != v1Metadata {
+		t.Error("migrateBundle() without write changed the metadata file")
+	}
+
+	// Rewrite, after which there is nothing left to do
+	if _, _, err = migrateBundle(dir, true); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(metadataPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if common.IsAxe_v1(data) {
+		t.Error("migrated metadata is still in the v1 format")
+	}
+	metadata, isV1, err := bundle.ParseMetadata(data, metadataPath)
+	if err != nil || isV1 {
+		t.Fatalf("ParseMetadata() = %v, %v", isV1, err)
+	}
+	if metadata.ApiVersion != "0.7" || len(metadata.Authors) != 1 || metadata.Authors[0].Name != "Jane" {
+		t.Errorf("migrated metadata = %+v", metadata)
+	}
+	if _, changed, err = migrateBundle(dir, true); err != nil || changed {
+		t.Errorf("second migrateBundle() = %v, %v, want no change", changed, err)
+	}
+}
+
+func TestMigrateAll(t *testing.T) {
+	defer func(f bool) { force = f }(force)
+
+	dir := filepath.Join(t.TempDir(), "old%d")
+	writeV1Bundle(t, dir)
+	tests := []struct {
+		force bool
+		want  string
+	}{
+		{false, "Metadata files that would migrate: 1\n    * old%d\n"},
+		{true, "Metadata files migrated: 1\n    * old%d\n"},
+	}
+	for _, test := range tests {
+		force = test.force
+		if summary := migrateAll([]string{dir}); !strings.Contains(summary, test.want) {
+			t.Errorf("migrateAll() with force %v = %q, want it to contain %q", test.force, summary, test.want)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+/* === This file is part of Relaxe - <https://github.com/teo/relaxe> ===
+ *
+ *   Copyright 2013, Teo Mrnjavac <teo@kde.org>
+ *
+ *   Relaxe is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   Relaxe is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with Relaxe. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/teo/relaxe/common"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+type publishResponse struct {
+	Data  *common.PublishResult `json:"data"`
+	Error interface{}           `json:"error"`
+}
+
+func isServerUrl(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
+
+// publishPackage uploads the axe file at axeFilePath and its signature, if any,
+// to the Relaxe server at serverUrl, authenticating with token. On a dry run
+// the server only checks the axe.
+func publishPackage(serverUrl string, token string, axeFilePath string, signature string, dryRun bool) (*common.PublishResult, error) {
+	f, err := os.Open(axeFilePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	body := new(bytes.Buffer)
+	w := multipart.NewWriter(body)
+	part, err := w.CreateFormFile("axe", path.Base(axeFilePath))
+	if err != nil {
+		return nil, err
+	}
+	if _, err = io.Copy(part, f); err != nil {
+		return nil, err
+	}
+	if signature != "" {
+		if err = w.WriteField("signature", signature); err != nil {
+			return nil, err
+		}
+	}
+	if dryRun {
+		if err = w.WriteField("dryRun", "true"); err != nil {
+			return nil, err
+		}
+	}
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", strings.TrimRight(serverUrl, "/")+"/v1/axes", body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return nil, fmt.Errorf("Relaxe server did not accept the publisher token (HTTP %v).", resp.StatusCode)
+	}
+
+	var r publishResponse
+	if err = json.Unmarshal(respBytes, &r); err != nil {
+		return nil, fmt.Errorf("Bad response from Relaxe server (HTTP %v).", resp.StatusCode)
+	}
+	if r.Error != nil {
+		return nil, fmt.Errorf("Relaxe server error: %v.", r.Error)
+	}
+	if r.Data == nil {
+		return nil, fmt.Errorf("Empty response from Relaxe server (HTTP %v).", resp.StatusCode)
+	}
+	return r.Data, nil
+}
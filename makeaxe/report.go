@@ -0,0 +1,167 @@
+/* === This file is part of Relaxe - <https://github.com/teo/relaxe> ===
+ *
+ *   Copyright 2013, Teo Mrnjavac <teo@kde.org>
+ *
+ *   Relaxe is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   Relaxe is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with Relaxe. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"github.com/teo/relaxe/common/util"
+	"io/ioutil"
+	"path"
+	"strings"
+)
+
+// bundleReport is the report entry for one bundle.
+type bundleReport struct {
+	Directory  string `json:"directory"`
+	PluginName string `json:"pluginName,omitempty"`
+	Version    string `json:"version,omitempty"`
+	Status     string `json:"status"` //built, skipped or error
+	Reason     string `json:"reason,omitempty"`
+	OutputPath string `json:"outputPath,omitempty"`
+	AxeId      string `json:"axeId,omitempty"`
+	Sha256     string `json:"sha256,omitempty"`
+}
+
+type buildReport struct {
+	DryRun  bool           `json:"dryRun,omitempty"` //if set, built means would be published and error would be rejected
+	Built   int            `json:"built"`
+	Skipped int            `json:"skipped"`
+	Errors  int            `json:"errors"`
+	Bundles []bundleReport `json:"bundles"`
+}
+
+func makeReport(results []buildResult) *buildReport {
+	report := &buildReport{DryRun: dryRun, Bundles: []bundleReport{}}
+	for _, r := range results {
+		entry := bundleReport{
+			Directory:  r.directory,
+			Status:     r.status.String(),
+			Reason:     r.reason,
+			OutputPath: r.outputPath,
+		}
+		if r.bundle != nil {
+			entry.PluginName = r.bundle.Metadata.PluginName
+			entry.Version = r.bundle.Metadata.Version
+			entry.AxeId = r.bundle.Metadata.AxeId
+			if r.status == statusBuilt {
+				entry.Sha256 = r.bundle.Sha256
+			}
+		}
+		if entry.Sha256 == "" && entry.OutputPath != "" { //not built in this run, e.g. up to date
+			if sum, err := util.Sha256sum(entry.OutputPath); err == nil {
+				entry.Sha256 = sum
+			}
+		}
+		switch r.status {
+		case statusBuilt:
+			report.Built++
+		case statusSkipped:
+			report.Skipped++
+		case statusError:
+			report.Errors++
+		}
+		report.Bundles = append(report.Bundles, entry)
+	}
+	return report
+}
+
+func writeJsonReport(reportPath string, results []buildResult) error {
+	data, err := json.MarshalIndent(makeReport(results), "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(reportPath, append(data, '\n'), 0644)
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitProperties struct {
+	Properties []junitProperty `xml:"property"`
+}
+
+type junitTestCase struct {
+	Name       string           `xml:"name,attr"`
+	ClassName  string           `xml:"classname,attr"`
+	Properties *junitProperties `xml:"properties,omitempty"`
+	Failure    *junitMessage    `xml:"failure,omitempty"`
+	Skipped    *junitMessage    `xml:"skipped,omitempty"`
+}
+
+type junitTestSuite struct {
+	XMLName   xml.Name        `xml:"testsuite"`
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+// writeJunitReport writes one test case per bundle, failed on build errors.
+func writeJunitReport(reportPath string, results []buildResult) error {
+	report := makeReport(results)
+	suite := junitTestSuite{
+		Name:     programName,
+		Tests:    len(report.Bundles),
+		Failures: report.Errors,
+		Skipped:  report.Skipped,
+	}
+	for _, b := range report.Bundles {
+		testCase := junitTestCase{Name: path.Base(b.Directory), ClassName: programName}
+		if b.PluginName != "" {
+			testCase.ClassName = programName + "." + b.PluginName
+		}
+		properties := &junitProperties{}
+		for _, p := range []junitProperty{
+			{"version", b.Version},
+			{"outputPath", b.OutputPath},
+			{"axeId", b.AxeId},
+			{"sha256", b.Sha256},
+		} {
+			if p.Value != "" {
+				properties.Properties = append(properties.Properties, p)
+			}
+		}
+		if len(properties.Properties) != 0 {
+			testCase.Properties = properties
+		}
+		message := &junitMessage{Message: strings.SplitN(b.Reason, "\n", 2)[0], Text: b.Reason}
+		switch b.Status {
+		case "error":
+			testCase.Failure = message
+		case "skipped":
+			testCase.Skipped = message
+		}
+		suite.TestCases = append(suite.TestCases, testCase)
+	}
+
+	data, err := xml.MarshalIndent(suite, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(reportPath, append([]byte(xml.Header), append(data, '\n')...), 0644)
+}
@@ -0,0 +1,80 @@
+/* === This file is part of Relaxe - <https://github.com/teo/relaxe> ===
+ *
+ *   Copyright 2013, Teo Mrnjavac <teo@kde.org>
+ *
+ *   Relaxe is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   Relaxe is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with Relaxe. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"github.com/teo/relaxe/common/util"
+	"io/ioutil"
+	"log"
+	"path"
+	"sync"
+)
+
+const buildStateFileName = ".makeaxe-state.json"
+
+// buildState remembers the input hash of every axe built in an output
+// directory, so that bundles are only rebuilt when their sources or build
+// options change.
+type buildState struct {
+	mutex  sync.Mutex
+	path   string
+	Hashes map[string]string `json:"hashes"` //axe file name => bundle input hash
+}
+
+func loadBuildState(outputPath string) *buildState {
+	this := new(buildState)
+	this.path = path.Join(outputPath, buildStateFileName)
+	this.Hashes = map[string]string{}
+
+	if ex, err := util.ExistsFile(this.path); !ex || err != nil {
+		return this
+	}
+	data, err := ioutil.ReadFile(this.path)
+	if err == nil {
+		err = json.Unmarshal(data, this)
+	}
+	if err != nil || this.Hashes == nil {
+		log.Printf("Warning: cannot read build state file %v, rebuilding everything.\n", this.path)
+		this.Hashes = map[string]string{}
+	}
+	return this
+}
+
+// changed returns whether an axe needs rebuilding, i.e. it was never built
+// here or its sources or build options changed since.
+func (this *buildState) changed(axeFileName string, inputHash string) bool {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.Hashes[axeFileName] != inputHash
+}
+
+func (this *buildState) record(axeFileName string, inputHash string) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.Hashes[axeFileName] = inputHash
+}
+
+func (this *buildState) save() error {
+	data, err := json.MarshalIndent(this, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(this.path, data, 0644)
+}
@@ -0,0 +1,181 @@
+/* === This file is part of Relaxe - <https://github.com/teo/relaxe> ===
+ *
+ *   Copyright 2013, Teo Mrnjavac <teo@kde.org>
+ *
+ *   Relaxe is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   Relaxe is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with Relaxe. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"github.com/coocood/jas"
+	"github.com/teo/relaxe/common"
+	"github.com/teo/relaxe/common/cache"
+	"github.com/teo/relaxe/common/catalog"
+	"log"
+	"net/http"
+)
+
+// Admin exposes catalog maintenance operations to publishers with the admin
+// flag set in the Relaxe configuration.
+type Admin struct {
+	axes *Axes
+}
+
+func NewAdmin(axes *Axes) *Admin {
+	this := new(Admin)
+	this.axes = axes
+	return this
+}
+
+// authorize returns the admin publisher who sent the request, or sets an error
+// on the context and returns nil.
+func (this *Admin) authorize(ctx *jas.Context) *common.Publisher {
+	publisher := this.axes.authenticate(ctx)
+	if publisher == nil {
+		unauthorized(ctx)
+		return nil
+	}
+	if !publisher.Admin {
+		ctx.Error = jas.RequestError{Message: "Forbidden", StatusCode: http.StatusForbidden}
+		return nil
+	}
+	return publisher
+}
+
+// catalogError reports a failed catalog operation to the client.
+func catalogError(ctx *jas.Context, err error) {
+	if err == catalog.ErrNotFound {
+		ctx.Error = jas.NewRequestError(err.Error())
+		return
+	}
+	log.Println("Error: Relaxe database error. " + err.Error())
+	ctx.Error = jas.NewInternalError(err)
+}
+
+// nameVersion returns the pluginName and version form values, or sets an error
+// on the context if either is missing.
+func nameVersion(ctx *jas.Context) (string, string, bool) {
+	pluginName := ctx.FormValue("pluginName")
+	version := ctx.FormValue("version")
+	if pluginName == "" || version == "" {
+		ctx.Error = jas.NewRequestError("pluginName and version are required")
+		return "", "", false
+	}
+	return pluginName, version, true
+}
+
+// `POST /admin/promote` with pluginName, version, channel 	==> { pluginName, version, channel }
+func (this *Admin) PostPromote(ctx *jas.Context) {
+	publisher := this.authorize(ctx)
+	if publisher == nil {
+		return
+	}
+
+	pluginName, version, ok := nameVersion(ctx)
+	if !ok {
+		return
+	}
+	channel := ctx.FormValue("channel")
+	if channel == "" || common.ChannelRank(channel) < 0 {
+		ctx.Error = jas.NewRequestError("Unknown channel " + channel)
+		return
+	}
+
+	if err := this.axes.catalog.SetChannel(pluginName, version, channel); err != nil {
+		catalogError(ctx, err)
+		return
+	}
+
+	log.Printf("* %v moved %v-%v to channel %v.\n", publisher.Name, pluginName, version, channel)
+	ctx.Data = map[string]string{"pluginName": pluginName, "version": version, "channel": channel}
+}
+
+// `POST /admin/scrub` with optional deleteOrphans=true 	==> ScrubReport
+// Axes with missing or corrupt files are hidden until the next scrub.
+func (this *Admin) PostScrub(ctx *jas.Context) {
+	publisher := this.authorize(ctx)
+	if publisher == nil {
+		return
+	}
+
+	report, err := this.axes.Scrub(ctx.FormValue("deleteOrphans") == "true")
+	if err != nil {
+		log.Println("Error: cannot scrub cache directory. " + err.Error())
+		ctx.Error = jas.NewInternalError(err)
+		return
+	}
+	log.Printf("* %v scrubbed the cache directory.\n", publisher.Name)
+	ctx.Data = report
+}
+
+func (this *Admin) setYanked(ctx *jas.Context, yanked bool) {
+	publisher := this.authorize(ctx)
+	if publisher == nil {
+		return
+	}
+	pluginName, version, ok := nameVersion(ctx)
+	if !ok {
+		return
+	}
+
+	if err := this.axes.catalog.SetYanked(pluginName, version, yanked); err != nil {
+		catalogError(ctx, err)
+		return
+	}
+
+	log.Printf("* %v set yanked to %v for %v-%v.\n", publisher.Name, yanked, pluginName, version)
+	ctx.Data = map[string]interface{}{"pluginName": pluginName, "version": version, "yanked": yanked}
+}
+
+// `POST /admin/yank` with pluginName, version 	==> { pluginName, version, yanked }
+// Clients get the newest version that isn't yanked instead.
+func (this *Admin) PostYank(ctx *jas.Context) {
+	this.setYanked(ctx, true)
+}
+
+// `POST /admin/unyank` with pluginName, version 	==> { pluginName, version, yanked }
+func (this *Admin) PostUnyank(ctx *jas.Context) {
+	this.setYanked(ctx, false)
+}
+
+// `POST /admin/delete` with pluginName, version 	==> { pluginName, version, axeIds }
+// Removes the version from the catalog and its files from the cache directory.
+func (this *Admin) PostDelete(ctx *jas.Context) {
+	publisher := this.authorize(ctx)
+	if publisher == nil {
+		return
+	}
+	pluginName, version, ok := nameVersion(ctx)
+	if !ok {
+		return
+	}
+
+	deleted, err := this.axes.catalog.Delete(pluginName, version)
+	if err != nil {
+		catalogError(ctx, err)
+		return
+	}
+
+	axeIds := []string{}
+	for i := range deleted {
+		if err := cache.Remove(this.axes.config.CacheDirectory, &deleted[i]); err != nil {
+			log.Printf("Warning: cannot remove files of axe %v. %v\n", cache.AxeFileName(&deleted[i]), err.Error())
+		}
+		axeIds = append(axeIds, deleted[i].AxeId)
+	}
+
+	log.Printf("* %v deleted %v-%v.\n", publisher.Name, pluginName, version)
+	ctx.Data = map[string]interface{}{"pluginName": pluginName, "version": version, "axeIds": axeIds}
+}
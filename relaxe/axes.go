@@ -20,20 +20,29 @@ package main
 
 import (
 	"github.com/coocood/jas"
-	"github.com/garyburd/redigo/redis"
 	"github.com/teo/relaxe/common"
+	"github.com/teo/relaxe/common/cache"
+	"github.com/teo/relaxe/common/catalog"
+	"github.com/teo/relaxe/common/counter"
 	"github.com/teo/relaxe/common/util"
-	"gopkg.in/mgo.v2"
-	"gopkg.in/mgo.v2/bson"
 	"log"
+	"net/http"
 	"path"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 )
 
 type Axes struct {
-	config *common.RelaxeConfig
-	c      *mgo.Collection
-	kv     redis.Conn
+	config  *common.RelaxeConfig
+	catalog catalog.Catalog
+	counter counter.Counter
+
+	hiddenMutex sync.RWMutex
+	hidden      map[string]bool //AxeIds of axes with missing or corrupt files, see Scrub
+
+	responses responseCache
 }
 
 func NewAxes(config *common.RelaxeConfig) (*Axes, error) {
@@ -41,106 +50,205 @@ func NewAxes(config *common.RelaxeConfig) (*Axes, error) {
 	this.config = config
 
 	// hook up to db
-	session, err := mgo.Dial(config.Database.ConnectionString)
+	var err error
+	this.catalog, err = catalog.Open(config)
 	if err != nil {
 		return this, err
 	}
 
-	this.c = session.DB("relaxe").C("axes")
-
-	this.kv, err = redis.Dial("tcp", config.KvStore.ConnectionString)
+	this.counter, err = counter.Open(config)
 
 	return this, err
 }
 
+func (this *Axes) Close() {
+	if this.counter != nil {
+		this.counter.Close()
+	}
+	if this.catalog != nil {
+		this.catalog.Close()
+	}
+}
+
 func (*Axes) Gap() string {
 	return ":resolverApiVersion/:platform/:name"
 }
 
+// newestAxe returns the newest axe that isn't yanked, or nil if there is none.
 func newestAxe(axes []common.Axe_v2) *common.Axe_v2 {
-	currentVersion := "0"
-	newestAxe := 0
+	newestAxe := -1
 
 	for i, _ := range axes {
-		if util.VersionCompare(axes[i].Version, currentVersion) > 0 {
-			currentVersion = axes[i].Version
+		if axes[i].Yanked {
+			continue
+		}
+		if newestAxe < 0 || util.VersionCompare(axes[i].Version, axes[newestAxe].Version) > 0 {
 			newestAxe = i
 		}
 	}
 
+	if newestAxe < 0 {
+		return nil
+	}
 	return &axes[newestAxe]
 }
 
-// `GET /axes/:version/:platform/` 			==> []Axe_v2 trimmed
-// `GET /axes/:version/:platform/:name` 	==> { pluginName, version, contentPath }
-func (this *Axes) Get(ctx *jas.Context) {
-	resolverApiVersion := ctx.GapSegment(":resolverApiVersion")
-	platform := ctx.GapSegment(":platform")
-	name := ctx.GapSegment(":name")
+// requestedChannel returns the release channel the client opted into with the
+// channel query parameter, stable by default.
+func requestedChannel(ctx *jas.Context) (string, jas.AppError) {
+	channel := ctx.FormValue("channel")
+	if channel == "" {
+		return common.Channels[0], nil
+	}
+	if common.ChannelRank(channel) < 0 {
+		return "", jas.NewRequestError("Unknown channel " + channel)
+	}
+	return channel, nil
+}
 
-	response := []common.Axe_v2{}
-	var err error
+// Clients list the resolver features they support in this header, or in the
+// features query parameter, comma separated.
+const featuresHeader = "X-Tomahawk-Features"
+
+// requestedFeatures returns the set of features the client supports, or nil if
+// it didn't say, which means it supports anything.
+func requestedFeatures(ctx *jas.Context) map[string]bool {
+	ctx.ParseForm()
+	list, ok := ctx.Form["features"]
+	if !ok {
+		list, ok = ctx.Header[featuresHeader]
+	}
+	if !ok {
+		return nil
+	}
+	features := map[string]bool{}
+	for _, item := range list {
+		for _, f := range strings.Split(item, ",") {
+			if f = strings.TrimSpace(f); f != "" {
+				features[f] = true
+			}
+		}
+	}
+	return features
+}
+
+// supportsAll returns whether features has all the features the axe needs.
+func supportsAll(features map[string]bool, axe *common.Axe_v2) bool {
+	if features == nil {
+		return true
+	}
+	for _, f := range axe.Features {
+		if !features[f] {
+			return false
+		}
+	}
+	return true
+}
+
+// compatibleAxes returns all the axes that can run on the given resolver API
+// version and platform, in the given channel or any more stable one, and that
+// need no other features than the given ones (any if nil), grouped by
+// pluginName. If name is set, only the axes with that pluginName are returned.
+func (this *Axes) compatibleAxes(resolverApiVersion string, platform string, name string, channel string, features map[string]bool) map[string][]common.Axe_v2 {
+	var (
+		response []common.Axe_v2
+		err      error
+	)
 
 	if name == "" {
-		err = this.c.Find(bson.M{"platform": bson.M{"$in": []string{"", "any", platform}}}).All(&response)
+		response, err = this.catalog.FindByPlatform(platform)
 	} else { //name not empty
-		err = this.c.Find(bson.M{"pluginname": name,
-			"platform": bson.M{"$in": []string{"", "any", platform}}}).All(&response)
+		response, err = this.catalog.FindByPluginName(name)
 	}
 
 	if err != nil {
 		log.Println(err.Error())
 	}
 
-	// apply version filters
+	// apply platform, version and channel filters
 	entries := map[string][]common.Axe_v2{}
 	for _, axe := range response {
-		if resolverApiVersion == "" || axe.ApiVersion == "" ||
-			util.VersionCompare(resolverApiVersion, axe.ApiVersion) >= 0 {
+		if common.ChannelRank(axe.Channel) > common.ChannelRank(channel) || this.isHidden(axe.AxeId) {
+			continue
+		}
+		if !axe.SupportsPlatform(platform) {
+			continue
+		}
+		if axe.Type == "resolver/binary" && axe.BinaryFor(platform) == nil {
+			continue
+		}
+		if !supportsAll(features, &axe) {
+			continue
+		}
+		if resolverApiVersion == "" || util.VersionSatisfies(resolverApiVersion, axe.ApiVersion) {
 			if entries[axe.PluginName] == nil {
 				entries[axe.PluginName] = []common.Axe_v2{}
 			}
 			entries[axe.PluginName] = append(entries[axe.PluginName], axe)
 		}
 	}
+	return entries
+}
 
-	response = []common.Axe_v2{}
-	for _, axes := range entries {
-		response = append(response, *newestAxe(axes))
+// resolveResponse returns what clients need to download and check an axe.
+// For binary resolvers, this includes the native library for the platform.
+func (this *Axes) resolveResponse(axe *common.Axe_v2, platform string) map[string]string {
+	realResponse := map[string]string{}
+	realResponse["pluginName"] = axe.PluginName
+	realResponse["version"] = axe.Version
+	realResponse["contentPath"] = path.Join(this.config.Server.CachePath, cache.AxeFileName(axe))
+	if axe.Sha256 != "" {
+		realResponse["sha256"] = axe.Sha256
+	}
+	if axe.Signature != "" {
+		realResponse["signature"] = axe.Signature
 	}
+	if b := axe.BinaryFor(platform); b != nil {
+		realResponse["binaryPath"] = b.Path
+		realResponse["binarySha256"] = b.Sha256
+		realResponse["binarySignature"] = axe.BinarySignature
+	}
+	return realResponse
+}
 
-	if name == "" {
-		for i, _ := range response {
-			response[i].Timestamp = nil
-			response[i].Manifest = nil
-			response[i].AxeId = ""
-			response[i].Features = []string{}
-			//don't ship legacy-formatted info
-			response[i].Author = ""
-			response[i].Email = ""
-			if dlcount, err := this.kv.Do("GET", "dlcount_"+response[i].PluginName); dlcount != nil && err == nil {
-				idlcount, _ := strconv.ParseInt(string(dlcount.([]byte)), 10, 64)
-				response[i].Downloads = &idlcount
-			} else {
-				log.Println("Error: cannot retrieve dlcount for " + response[i].PluginName)
-			}
-		}
+// All of these take an optional channel=stable|beta|nightly query parameter, and
+// answer conditional requests (If-None-Match, If-Modified-Since) with 304.
+// Clients that send the features they support, see requestedFeatures, only get
+// the versions they can run.
+// `GET /axes/:version/:platform/` 			==> []Axe_v2 trimmed, with the total count in X-Total-Count
+// The listing takes optional q (search in name, description and authors), type, license,
+// sort=name|downloads|newest, limit and offset query parameters.
+// `GET /axes/:version/:platform/:name` 	==> { pluginName, version, contentPath, sha256, signature }
+// Binary resolvers also get { binaryPath, binarySha256, binarySignature } for the platform.
+// `GET /axes/:version/:platform/:name?version=X` 	==> same as above, for version X instead of the newest
+// Yanked versions are never the newest, but can still be asked for with version=X.
+func (this *Axes) Get(ctx *jas.Context) {
+	resolverApiVersion := ctx.GapSegment(":resolverApiVersion")
+	platform := ctx.GapSegment(":platform")
+	name := ctx.GapSegment(":name")
+	pinnedVersion := ctx.FormValue("version")
+	channel, appErr := requestedChannel(ctx)
+	if appErr != nil {
+		ctx.Error = appErr
+		return
+	}
+	query, appErr := parseListingQuery(ctx)
+	if appErr != nil {
+		ctx.Error = appErr
+		return
+	}
+	features := requestedFeatures(ctx)
 
-		ctx.Data = response
-	} else {
-		if len(response) != 1 {
-			log.Println("Error: bad entry count for pluginName " + name)
-			return
+	data := this.cachedGet(ctx, func(header http.Header) (interface{}, jas.AppError) {
+		if name == "" {
+			return this.listingResponse(resolverApiVersion, platform, channel, features, query, header), nil
 		}
-		realResponse := map[string]string{}
-		realResponse["pluginName"] = response[0].PluginName
-		realResponse["version"] = response[0].Version
-		axeFilename := response[0].PluginName + "-" + response[0].AxeId + ".axe"
-		realResponse["contentPath"] = path.Join(this.config.Server.CachePath, axeFilename)
-		ctx.Data = realResponse
+		return this.resolveResponseFor(resolverApiVersion, platform, name, pinnedVersion, channel, features)
+	})
 
-		key := "dlcount_" + response[0].PluginName
-		_, err = this.kv.Do("INCR", key)
+	// Count a download only if the client didn't have the response already
+	if name != "" && data != nil {
+		_, err := this.counter.Incr(name)
 		if err != nil {
 			log.Println("Error: could not increment download count for " + name)
 		}
@@ -150,3 +258,124 @@ func (this *Axes) Get(ctx *jas.Context) {
 		log.Println(ctx.Error)
 	}
 }
+
+// listingResponse returns the newest version of every compatible axe that
+// matches the query, trimmed, sorted and paged. The total number of matching
+// axes goes in the X-Total-Count header.
+func (this *Axes) listingResponse(resolverApiVersion string, platform string, channel string, features map[string]bool, query *listingQuery, header http.Header) []common.Axe_v2 {
+	response := []common.Axe_v2{}
+	for _, axes := range this.compatibleAxes(resolverApiVersion, platform, "", channel, features) {
+		if newest := newestAxe(axes); newest != nil && query.matches(newest) {
+			response = append(response, *newest)
+		}
+	}
+
+	downloads := map[string]int64{}
+	dlcount := func(pluginName string) {
+		if _, ok := downloads[pluginName]; ok {
+			return
+		}
+		if count, err := this.counter.Get(pluginName); err == nil {
+			downloads[pluginName] = count
+		} else {
+			log.Println("Error: cannot retrieve dlcount for " + pluginName)
+		}
+	}
+	if query.sortBy == "downloads" {
+		for i := range response {
+			dlcount(response[i].PluginName)
+		}
+	}
+	query.sort(response, downloads)
+	header.Set("X-Total-Count", strconv.Itoa(len(response)))
+	response = query.page(response)
+
+	for i, _ := range response {
+		response[i].Timestamp = nil
+		response[i].Manifest = nil
+		response[i].AxeId = ""
+		response[i].Publisher = ""
+		response[i].Signature = ""
+		response[i].Sha256 = ""
+		response[i].Binaries = nil
+		response[i].BinarySignature = ""
+		if response[i].Features == nil {
+			response[i].Features = []string{}
+		}
+		//don't ship legacy-formatted info
+		response[i].Author = ""
+		response[i].Email = ""
+		dlcount(response[i].PluginName)
+		if count, ok := downloads[response[i].PluginName]; ok {
+			response[i].Downloads = &count
+		}
+	}
+	return response
+}
+
+// resolveResponseFor returns the resolve response for the newest compatible
+// version of an axe, or for pinnedVersion if set, and nil if there is none.
+func (this *Axes) resolveResponseFor(resolverApiVersion string, platform string, name string, pinnedVersion string, channel string, features map[string]bool) (interface{}, jas.AppError) {
+	response := []common.Axe_v2{}
+	for _, axes := range this.compatibleAxes(resolverApiVersion, platform, name, channel, features) {
+		if pinnedVersion != "" {
+			for i := range axes {
+				if axes[i].Version == pinnedVersion {
+					response = append(response, axes[i])
+				}
+			}
+			continue
+		}
+		if newest := newestAxe(axes); newest != nil {
+			response = append(response, *newest)
+		}
+	}
+
+	if len(response) != 1 {
+		log.Println("Error: bad entry count for pluginName " + name)
+		if pinnedVersion != "" {
+			return nil, jas.NewRequestError("No compatible version " + pinnedVersion + " of " + name)
+		}
+		return nil, nil
+	}
+	return this.resolveResponse(&response[0], platform), nil
+}
+
+type axeVersion struct {
+	Version    string `json:"version"`
+	Timestamp  *int64 `json:"timestamp,omitempty"`
+	Revision   string `json:"revision,omitempty"`
+	ApiVersion string `json:"apiVersion"`
+	Channel    string `json:"channel,omitempty"`
+	Yanked     bool   `json:"yanked,omitempty"`
+}
+
+// `GET /axes/:version/:platform/:name/versions` 	==> []{ version, timestamp, revision, apiVersion, channel, yanked }, newest first
+func (this *Axes) GetVersions(ctx *jas.Context) {
+	resolverApiVersion := ctx.GapSegment(":resolverApiVersion")
+	platform := ctx.GapSegment(":platform")
+	name := ctx.GapSegment(":name")
+
+	if name == "" {
+		ctx.Error = jas.NewRequestError("A pluginName is required to list versions")
+		return
+	}
+	channel, appErr := requestedChannel(ctx)
+	if appErr != nil {
+		ctx.Error = appErr
+		return
+	}
+
+	this.cachedGet(ctx, func(header http.Header) (interface{}, jas.AppError) {
+		axes := this.compatibleAxes(resolverApiVersion, platform, name, channel, requestedFeatures(ctx))[name]
+		sort.Slice(axes, func(i, j int) bool {
+			return util.VersionCompare(axes[i].Version, axes[j].Version) > 0
+		})
+
+		response := []axeVersion{}
+		for _, axe := range axes {
+			response = append(response, axeVersion{axe.Version, axe.Timestamp, axe.Revision, axe.ApiVersion, axe.Channel, axe.Yanked})
+		}
+		return response, nil
+	})
+}
@@ -0,0 +1,174 @@
+/* === This file is part of Relaxe - <https://github.com/teo/relaxe> ===
+ *
+ *   Copyright 2013, Teo Mrnjavac <teo@kde.org>
+ *
+ *   Relaxe is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   Relaxe is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with Relaxe. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"github.com/teo/relaxe/common"
+	"path/filepath"
+	"testing"
+)
+
+// newTestAxes returns Axes on a file catalog and download counter in a
+// temporary directory.
+func newTestAxes(t *testing.T) *Axes {
+	dir := t.TempDir()
+	config := new(common.RelaxeConfig)
+	config.CacheDirectory = dir
+	config.Database.Type = "file"
+	config.Database.Path = filepath.Join(dir, "catalog.json")
+	config.KvStore.Type = "file"
+	config.KvStore.Path = filepath.Join(dir, "downloads.json")
+	config.Server.CachePath = "/axes"
+
+	axes, err := NewAxes(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(axes.Close)
+	return axes
+}
+
+// testMetadata returns valid metadata for a javascript resolver.
+func testMetadata(pluginName string, version string) *common.Axe_v2 {
+	metadata := new(common.Axe_v2)
+	err := json.Unmarshal([]byte(`{
+		"name": "Test",
+		"description": "A resolver for testing.",
+		"platform": "any",
+		"apiVersion": "0.1",
+		"type": "resolver/javascript",
+		"manifest": {"main": "main.js", "icon": "icon.png"}
+	}`), metadata)
+	if err != nil {
+		panic(err)
+	}
+	metadata.PluginName = pluginName
+	metadata.Version = version
+	return metadata
+}
+
+// axeArchive returns an axe file with just the given metadata in it.
+func axeArchive(t *testing.T, metadata *common.Axe_v2) []byte {
+	var buf bytes.Buffer
+	z := zip.NewWriter(&buf)
+	w, err := z.Create(common.MetadataPath)
+	if err == nil {
+		err = json.NewEncoder(w).Encode(metadata)
+	}
+	if err == nil {
+		err = z.Close()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestPublish(t *testing.T) {
+	axes := newTestAxes(t)
+	publisher := &common.Publisher{Name: "tester"}
+
+	yanked := testMetadata("foo", "1.0.0")
+	yanked.Yanked = true
+	data := axeArchive(t, yanked)
+	result := axes.publish(publisher, data, "", false)
+	if result.Status != "published" {
+		t.Fatalf("publish() = %+v, want published", result)
+	}
+	published, err := axes.catalog.FindByPluginName("foo")
+	if err != nil || len(published) != 1 {
+		t.Fatalf("FindByPluginName() = %v, %v, want the published axe", published, err)
+	}
+	if want := fmt.Sprintf("%x", sha256.Sum256(data)); published[0].Sha256 != want {
+		t.Errorf("catalog sha256 = %v, want %v", published[0].Sha256, want)
+	}
+	if published[0].Yanked || published[0].Publisher != "tester" || published[0].AxeId != result.AxeId {
+		t.Errorf("server fields not set on publish: %+v", published[0])
+	}
+
+	tests := []struct {
+		name     string
+		metadata *common.Axe_v2
+		dryRun   bool
+		status   string
+	}{
+		{"same version", testMetadata("foo", "1.0.0"), false, "skipped"},
+		{"dry run", testMetadata("bar", "1.0.0"), true, "accepted"},
+		{"path in pluginName", testMetadata("../bar", "1.0.0"), false, "rejected"},
+		{"incomplete metadata", &common.Axe_v2{PluginName: "bar"}, false, "rejected"},
+	}
+	for _, test := range tests {
+		if result := axes.publish(publisher, axeArchive(t, test.metadata), "", test.dryRun); result.Status != test.status {
+			t.Errorf("%v: publish() = %+v, want %v", test.name, result, test.status)
+		}
+	}
+	for pluginName, want := range map[string]int{"foo": 1, "bar": 0} {
+		if count, _ := axes.catalog.CountByNameVersion(pluginName, "1.0.0"); count != want {
+			t.Errorf("catalog has %v axes %v-1.0.0 after skipped, dry run and rejected publishes, want %v", count, pluginName, want)
+		}
+	}
+}
+
+func TestResolveResponse(t *testing.T) {
+	axes := newTestAxes(t)
+
+	plain := testMetadata("foo", "1.0.0")
+	plain.AxeId = "id"
+
+	checked := testMetadata("foo", "1.0.0")
+	checked.AxeId = "id"
+	checked.Sha256 = "abc"
+	checked.Signature = "sig"
+
+	binary := testMetadata("bar", "2.0.0")
+	binary.AxeId = "id2"
+	binary.Type = "resolver/binary"
+	binary.BinarySignature = "binsig"
+	binary.Binaries = []common.Binary{
+		{Platform: "linux-x86_64", Path: "linux/libbar.so", Sha256: "l"},
+		{Platform: "win32", Path: "win/bar.dll", Sha256: "w"},
+	}
+
+	tests := []struct {
+		name     string
+		axe      *common.Axe_v2
+		platform string
+		want     map[string]string
+	}{
+		{"no checksum", plain, "linux", map[string]string{
+			"pluginName": "foo", "version": "1.0.0", "contentPath": "/axes/foo-id.axe"}},
+		{"checksum and signature", checked, "linux", map[string]string{
+			"pluginName": "foo", "version": "1.0.0", "contentPath": "/axes/foo-id.axe",
+			"sha256": "abc", "signature": "sig"}},
+		{"binary", binary, "windows", map[string]string{
+			"pluginName": "bar", "version": "2.0.0", "contentPath": "/axes/bar-id2.axe",
+			"binaryPath": "win/bar.dll", "binarySha256": "w", "binarySignature": "binsig"}},
+	}
+	for _, test := range tests {
+		got := axes.resolveResponse(test.axe, test.platform)
+		if fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf("%v: resolveResponse() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
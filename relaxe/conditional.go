@@ -0,0 +1,184 @@
+/* === This file is part of Relaxe - <https://github.com/teo/relaxe> ===
+ *
+ *   Copyright 2013, Teo Mrnjavac <teo@kde.org>
+ *
+ *   Relaxe is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   Relaxe is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with Relaxe. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"github.com/coocood/jas"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	apiMaxAge = 60 * time.Second //how long clients may use API responses without asking again
+
+	// Cached responses are recomputed after this long even if the catalog
+	// didn't change, to pick up new download counts.
+	responseCacheTTL = 5 * time.Minute
+	// The cache is emptied when it grows over this many entries.
+	responseCacheSize = 1024
+)
+
+// Request headers that responses depend on.
+var varyHeaders = []string{featuresHeader}
+
+type cachedResponse struct {
+	data     interface{}
+	header   http.Header //extra response headers
+	etag     string
+	revision string
+	expires  time.Time
+}
+
+// responseCache keeps API responses by request URI for the current catalog
+// revision, so that polling clients don't cost a catalog query each time.
+type responseCache struct {
+	mutex     sync.Mutex
+	responses map[string]*cachedResponse
+}
+
+func (this *responseCache) get(key string, revision string) *cachedResponse {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	r := this.responses[key]
+	if r == nil || r.revision != revision || time.Now().After(r.expires) {
+		return nil
+	}
+	return r
+}
+
+func (this *responseCache) put(key string, revision string, data interface{}, header http.Header) (*cachedResponse, error) {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	r := &cachedResponse{
+		data:     data,
+		header:   header,
+		etag:     fmt.Sprintf("\"%x\"", sha256.Sum256(body)),
+		revision: revision,
+		expires:  time.Now().Add(responseCacheTTL),
+	}
+
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if this.responses == nil || len(this.responses) >= responseCacheSize {
+		this.responses = map[string]*cachedResponse{}
+	}
+	this.responses[key] = r
+	return r, nil
+}
+
+func (this *responseCache) clear() {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.responses = nil
+}
+
+// notModified returns whether a conditional request can be answered with
+// 304 Not Modified. If-None-Match takes precedence over If-Modified-Since.
+func notModified(r *http.Request, etag string, modified time.Time) bool {
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		for _, candidate := range strings.Split(match, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || candidate == etag {
+				return true
+			}
+		}
+		return false
+	}
+	if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !modified.IsZero() {
+		return !modified.Truncate(time.Second).After(since)
+	}
+	return false
+}
+
+// cachedGet answers a GET request with the data returned by compute, which is
+// only called when the catalog changed since the response was last cached.
+// Headers that compute sets are cached along with the data. cachedGet sets the
+// caching headers, and answers conditional requests with 304 Not Modified. It
+// returns the data sent to the client, nil if none was.
+func (this *Axes) cachedGet(ctx *jas.Context, compute func(header http.Header) (interface{}, jas.AppError)) interface{} {
+	revision, err := this.catalog.Revision()
+	if err != nil { //can't validate responses, don't cache them
+		log.Println("Error: cannot get catalog revision. " + err.Error())
+		data, appErr := compute(ctx.ResponseHeader)
+		ctx.Data, ctx.Error = data, appErr
+		return data
+	}
+
+	key := ctx.URL.RequestURI()
+	for _, name := range varyHeaders {
+		key += "\n" + strings.Join(ctx.Header[name], ",")
+	}
+	r := this.responses.get(key, revision.Id)
+	if r == nil {
+		header := http.Header{}
+		data, appErr := compute(header)
+		if appErr != nil {
+			ctx.Error = appErr
+			return nil
+		}
+		if data == nil {
+			return nil
+		}
+		if r, err = this.responses.put(key, revision.Id, data, header); err != nil {
+			ctx.Data = data
+			return data
+		}
+	}
+
+	for name, values := range r.header {
+		ctx.ResponseHeader[name] = values
+	}
+
+	ctx.ResponseHeader.Set("Vary", strings.Join(varyHeaders, ", "))
+	ctx.ResponseHeader.Set("ETag", r.etag)
+	if !revision.Modified.IsZero() {
+		ctx.ResponseHeader.Set("Last-Modified", revision.Modified.UTC().Format(http.TimeFormat))
+	}
+	ctx.ResponseHeader.Set("Cache-Control", fmt.Sprintf("public, max-age=%v", int(apiMaxAge.Seconds())))
+
+	if notModified(ctx.Request, r.etag, revision.Modified) {
+		ctx.Status = http.StatusNotModified
+		return nil
+	}
+	ctx.Data = r.data
+	return r.data
+}
+
+// immutableFiles adds long-lived caching headers to downloads from the axes
+// cache. Axe files are named after their AxeId, so they never change.
+func immutableFiles(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, ext := range []string{".axe", ".md5", ".sig"} {
+			if strings.HasSuffix(r.URL.Path, ext) {
+				w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+				break
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,142 @@
+/* === This file is part of Relaxe - <https://github.com/teo/relaxe> ===
+ *
+ *   Copyright 2013, Teo Mrnjavac <teo@kde.org>
+ *
+ *   Relaxe is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   Relaxe is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with Relaxe. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"github.com/coocood/jas"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNotModified(t *testing.T) {
+	etag := `"abc"`
+	modified := time.Date(2013, 10, 1, 12, 0, 0, 500, time.UTC)
+	tests := []struct {
+		ifNoneMatch     string
+		ifModifiedSince string
+		modified        time.Time
+		want            bool
+	}{
+		{"", "", modified, false},
+		{`"abc"`, "", modified, true},
+		{`"xyz", "abc"`, "", modified, true},
+		{`"xyz"`, "", modified, false},
+		{`W/"abc"`, "", modified, false},
+		{"*", "", modified, true},
+		{"", "Tue, 01 Oct 2013 12:00:00 GMT", modified, true},
+		{"", "Wed, 02 Oct 2013 08:00:00 GMT", modified, true},
+		{"", "Tue, 01 Oct 2013 11:59:59 GMT", modified, false},
+		{"", "Tue, 01 Oct 2013 12:00:00 GMT", time.Time{}, false},
+		{"", "yesterday", modified, false},
+		{`"xyz"`, "Tue, 01 Oct 2013 12:00:00 GMT", modified, false},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/axes", nil)
+		if test.ifNoneMatch != "" {
+			r.Header.Set("If-None-Match", test.ifNoneMatch)
+		}
+		if test.ifModifiedSince != "" {
+			r.Header.Set("If-Modified-Since", test.ifModifiedSince)
+		}
+		if got := notModified(r, etag, test.modified); got != test.want {
+			t.Errorf("notModified(If-None-Match: %v, If-Modified-Since: %v, modified %v) = %v, want %v",
+				test.ifNoneMatch, test.ifModifiedSince, test.modified, got, test.want)
+		}
+	}
+}
+
+func TestCachedGet(t *testing.T) {
+	axes := newTestAxes(t)
+	computed := 0
+	compute := func(header http.Header) (interface{}, jas.AppError) {
+		computed++
+		header.Set("X-Computed", "yes")
+		return []int{computed}, nil
+	}
+	get := func(header string, value string) *jas.Context {
+		r := httptest.NewRequest("GET", "/axes?name=foo", nil)
+		if header != "" {
+			r.Header.Set(header, value)
+		}
+		ctx := &jas.Context{Request: r, ResponseHeader: http.Header{}}
+		axes.cachedGet(ctx, compute)
+		return ctx
+	}
+
+	first := get("", "")
+	etag := first.ResponseHeader.Get("ETag")
+	lastModified := first.ResponseHeader.Get("Last-Modified")
+	if computed != 1 || first.Data == nil || etag == "" {
+		t.Fatalf("first GET: computed %v times, data %v, ETag %q", computed, first.Data, etag)
+	}
+	revision, err := axes.catalog.Revision()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := revision.Modified.UTC().Format(http.TimeFormat); lastModified != want {
+		t.Errorf("Last-Modified = %q, want %q", lastModified, want)
+	}
+
+	cached := get("", "")
+	if computed != 1 || cached.ResponseHeader.Get("ETag") != etag || cached.ResponseHeader.Get("X-Computed") != "yes" {
+		t.Errorf("second GET: computed %v times, headers %v", computed, cached.ResponseHeader)
+	}
+
+	for _, header := range []string{"If-None-Match", "If-Modified-Since"} {
+		value := etag
+		if header == "If-Modified-Since" {
+			value = lastModified
+		}
+		conditional := get(header, value)
+		if conditional.Status != http.StatusNotModified || conditional.Data != nil {
+			t.Errorf("GET with %v: status %v, data %v, want 304 without data", header, conditional.Status, conditional.Data)
+		}
+	}
+
+	if err := axes.catalog.Insert(testMetadata("foo", "1.0.0")); err != nil {
+		t.Fatal(err)
+	}
+	changed := get("If-None-Match", etag)
+	if computed != 2 || changed.Status == http.StatusNotModified {
+		t.Errorf("GET after catalog change: computed %v times, status %v", computed, changed.Status)
+	}
+}
+
+func TestImmutableFiles(t *testing.T) {
+	h := immutableFiles(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	tests := []struct {
+		path      string
+		immutable bool
+	}{
+		{"/axes/id.axe", true},
+		{"/axes/id.md5", true},
+		{"/axes/id.sig", true},
+		{"/axes/", false},
+		{"/axes/notes.txt", false},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", test.path, nil))
+		if got := w.Header().Get("Cache-Control") != ""; got != test.immutable {
+			t.Errorf("%v: Cache-Control %q", test.path, w.Header().Get("Cache-Control"))
+		}
+	}
+}
@@ -0,0 +1,132 @@
+/* === This file is part of Relaxe - <https://github.com/teo/relaxe> ===
+ *
+ *   Copyright 2013, Teo Mrnjavac <teo@kde.org>
+ *
+ *   Relaxe is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   Relaxe is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with Relaxe. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"github.com/coocood/jas"
+	"github.com/teo/relaxe/common"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// listingQuery holds the search, filter, sort and pagination parameters of an
+// axe listing.
+type listingQuery struct {
+	words   []string //all must appear in the name, description or authors
+	axeType string
+	license string
+	sortBy  string //name (default), downloads or newest
+	limit   int    //0 for no limit
+	offset  int
+}
+
+func parseListingQuery(ctx *jas.Context) (*listingQuery, jas.AppError) {
+	this := new(listingQuery)
+	this.words = strings.Fields(strings.ToLower(ctx.FormValue("q")))
+	this.axeType = ctx.FormValue("type")
+	this.license = ctx.FormValue("license")
+
+	this.sortBy = ctx.FormValue("sort")
+	switch this.sortBy {
+	case "":
+		this.sortBy = "name"
+	case "name", "downloads", "newest":
+	default:
+		return nil, jas.NewRequestError("Unknown sort order " + this.sortBy)
+	}
+
+	for _, p := range []struct {
+		name  string
+		value *int
+	}{{"limit", &this.limit}, {"offset", &this.offset}} {
+		if s := ctx.FormValue(p.name); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 0 {
+				return nil, jas.NewRequestError("Bad " + p.name + " " + s)
+			}
+			*p.value = n
+		}
+	}
+	return this, nil
+}
+
+func (this *listingQuery) matches(axe *common.Axe_v2) bool {
+	if this.axeType != "" && axe.Type != this.axeType && axe.Type != "resolver/"+this.axeType {
+		return false
+	}
+	if this.license != "" && !strings.EqualFold(axe.License, this.license) {
+		return false
+	}
+
+	text := []string{axe.PluginName, axe.Name, axe.Description, axe.Author}
+	for _, a := range axe.Authors {
+		text = append(text, a.Name)
+	}
+	haystack := strings.ToLower(strings.Join(text, "\n"))
+	for _, word := range this.words {
+		if !strings.Contains(haystack, word) {
+			return false
+		}
+	}
+	return true
+}
+
+// sort orders axes in place. downloads is only used when sorting by downloads.
+func (this *listingQuery) sort(axes []common.Axe_v2, downloads map[string]int64) {
+	byName := func(i, j int) bool {
+		a, b := strings.ToLower(axes[i].Name), strings.ToLower(axes[j].Name)
+		if a != b {
+			return a < b
+		}
+		return axes[i].PluginName < axes[j].PluginName
+	}
+	timestamp := func(axe *common.Axe_v2) int64 {
+		if axe.Timestamp == nil {
+			return 0
+		}
+		return *axe.Timestamp
+	}
+
+	sort.Slice(axes, func(i, j int) bool {
+		switch this.sortBy {
+		case "downloads":
+			if a, b := downloads[axes[i].PluginName], downloads[axes[j].PluginName]; a != b {
+				return a > b
+			}
+		case "newest":
+			if a, b := timestamp(&axes[i]), timestamp(&axes[j]); a != b {
+				return a > b
+			}
+		}
+		return byName(i, j)
+	})
+}
+
+// page returns the part of axes selected by offset and limit.
+func (this *listingQuery) page(axes []common.Axe_v2) []common.Axe_v2 {
+	if this.offset >= len(axes) {
+		return []common.Axe_v2{}
+	}
+	axes = axes[this.offset:]
+	if this.limit != 0 && this.limit < len(axes) {
+		axes = axes[:this.limit]
+	}
+	return axes
+}
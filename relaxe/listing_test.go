@@ -0,0 +1,130 @@
+/* === This file is part of Relaxe - <https://github.com/teo/relaxe> ===
+ *
+ *   Copyright 2013, Teo Mrnjavac <teo@kde.org>
+ *
+ *   Relaxe is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   Relaxe is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with Relaxe. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"github.com/coocood/jas"
+	"github.com/teo/relaxe/common"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func listingContext(query string) *jas.Context {
+	return &jas.Context{Request: httptest.NewRequest("GET", "/axes?"+query, nil), ResponseHeader: http.Header{}}
+}
+
+func TestParseListingQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  *listingQuery // nil for a request error
+	}{
+		{"", &listingQuery{sortBy: "name"}},
+		{"q=Spotify+Music&type=javascript&license=GPL-3.0&sort=newest&limit=10&offset=20",
+			&listingQuery{words: []string{"spotify", "music"}, axeType: "javascript", license: "GPL-3.0", sortBy: "newest", limit: 10, offset: 20}},
+		{"sort=downloads", &listingQuery{sortBy: "downloads"}},
+		{"sort=size", nil},
+		{"limit=ten", nil},
+		{"limit=-1", nil},
+		{"offset=-5", nil},
+	}
+	for _, test := range tests {
+		got, err := parseListingQuery(listingContext(test.query))
+		if test.want == nil {
+			if err == nil {
+				t.Errorf("parseListingQuery(%q) = %+v, want an error", test.query, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseListingQuery(%q) error %v", test.query, err)
+			continue
+		}
+		if len(got.words) == 0 && len(test.want.words) == 0 { //strings.Fields returns an empty slice, not nil
+			got.words = nil
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parseListingQuery(%q) = %+v, want %+v", test.query, got, test.want)
+		}
+	}
+}
+
+func TestListingMatches(t *testing.T) {
+	axe := testMetadata("spotify", "1.0.0")
+	axe.Name = "Spotify"
+	axe.Description = "Streams music from Spotify."
+	axe.License = "GPL-3.0"
+	axe.Authors = []common.Author{{Name: "Jane Doe"}}
+
+	tests := []struct {
+		query listingQuery
+		want  bool
+	}{
+		{listingQuery{}, true},
+		{listingQuery{axeType: "javascript"}, true},
+		{listingQuery{axeType: "resolver/javascript"}, true},
+		{listingQuery{axeType: "binary"}, false},
+		{listingQuery{license: "gpl-3.0"}, true},
+		{listingQuery{license: "MIT"}, false},
+		{listingQuery{words: []string{"music", "jane"}}, true},
+		{listingQuery{words: []string{"streams", "spotify"}}, true},
+		{listingQuery{words: []string{"music", "video"}}, false},
+	}
+	for _, test := range tests {
+		if got := test.query.matches(axe); got != test.want {
+			t.Errorf("%+v matches() = %v, want %v", test.query, got, test.want)
+		}
+	}
+}
+
+func TestListingSortAndPage(t *testing.T) {
+	timestamp := func(t int64) *int64 { return &t }
+	axes := []common.Axe_v2{
+		{PluginName: "c", Name: "Charlie", Timestamp: timestamp(300)},
+		{PluginName: "a", Name: "alpha", Timestamp: timestamp(100)},
+		{PluginName: "b2", Name: "Bravo", Timestamp: timestamp(200)},
+		{PluginName: "b1", Name: "bravo"},
+	}
+	downloads := map[string]int64{"a": 5, "c": 5, "b1": 10}
+
+	tests := []struct {
+		query listingQuery
+		want  []string
+	}{
+		{listingQuery{sortBy: "name"}, []string{"a", "b1", "b2", "c"}},
+		{listingQuery{sortBy: "downloads"}, []string{"b1", "a", "c", "b2"}},
+		{listingQuery{sortBy: "newest"}, []string{"c", "b2", "a", "b1"}},
+		{listingQuery{sortBy: "name", limit: 2}, []string{"a", "b1"}},
+		{listingQuery{sortBy: "name", offset: 3, limit: 2}, []string{"c"}},
+		{listingQuery{sortBy: "name", offset: 4}, []string{}},
+		{listingQuery{sortBy: "name", offset: 10}, []string{}},
+	}
+	for _, test := range tests {
+		sorted := append([]common.Axe_v2{}, axes...)
+		test.query.sort(sorted, downloads)
+		got := []string{}
+		for _, axe := range test.query.page(sorted) {
+			got = append(got, axe.PluginName)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%+v: got %v, want %v", test.query, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+/* === This file is part of Relaxe - <https://github.com/teo/relaxe> ===
+ *
+ *   Copyright 2013, Teo Mrnjavac <teo@kde.org>
+ *
+ *   Relaxe is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   Relaxe is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with Relaxe. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"github.com/coocood/jas"
+	"github.com/nu7hatch/gouuid"
+	"github.com/teo/relaxe/common"
+	"github.com/teo/relaxe/common/cache"
+	"github.com/teo/relaxe/common/catalog"
+	"github.com/teo/relaxe/common/signing"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+)
+
+const (
+	maxAxeSize      = 32 << 20
+	maxFormOverhead = 1 << 20 //for the signature and the multipart headers
+)
+
+// authenticate returns the publisher whose token was sent in the
+// Authorization header, or nil if there is no such publisher.
+func (this *Axes) authenticate(ctx *jas.Context) *common.Publisher {
+	token := strings.TrimSpace(strings.TrimPrefix(ctx.Header.Get("Authorization"), "Bearer "))
+	if token == "" {
+		return nil
+	}
+	for i, p := range this.config.Publishers {
+		if p.Token != "" && subtle.ConstantTimeCompare([]byte(p.Token), []byte(token)) == 1 {
+			return &this.config.Publishers[i]
+		}
+	}
+	return nil
+}
+
+// unauthorized answers a request without a valid publisher token with 401
+// Unauthorized, so that clients can tell it from a bad request.
+func unauthorized(ctx *jas.Context) {
+	ctx.ResponseHeader.Set("WWW-Authenticate", `Bearer realm="Relaxe"`)
+	ctx.Error = jas.RequestError{Message: "Unauthorized", StatusCode: http.StatusUnauthorized}
+}
+
+// verifySignature checks the signature of an axe file against the trusted
+// keys of its publisher.
+func verifySignature(publisher *common.Publisher, data []byte, signature string) bool {
+	for _, encodedKey := range publisher.PublicKeys {
+		key, err := signing.DecodePublicKey(encodedKey)
+		if err != nil {
+			log.Printf("Warning: %v for publisher %v.\n", err.Error(), publisher.Name)
+			continue
+		}
+		if signing.Verify(key, data, signature) {
+			return true
+		}
+	}
+	return false
+}
+
+// axeTooLarge answers a publish request with 413 Request Entity Too Large.
+func axeTooLarge(ctx *jas.Context) {
+	ctx.Error = jas.RequestError{
+		Message:    fmt.Sprintf("Axe is larger than %v bytes.", maxAxeSize),
+		StatusCode: http.StatusRequestEntityTooLarge,
+	}
+}
+
+// `POST /axes` with a multipart "axe" file and optional "signature" 	==> PublishResult
+// With dryRun=true, the axe is checked but not published, and the status is accepted if it would be.
+func (this *Axes) Post(ctx *jas.Context) {
+	publisher := this.authenticate(ctx)
+	if publisher == nil {
+		unauthorized(ctx)
+		return
+	}
+
+	// ParseMultipartForm only keeps maxAxeSize in memory and spills the rest
+	// to temporary files, the request body itself must be limited
+	ctx.Request.Body = http.MaxBytesReader(ctx.ResponseWriter, ctx.Request.Body, maxAxeSize+maxFormOverhead)
+	if err := ctx.ParseMultipartForm(maxAxeSize); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			axeTooLarge(ctx)
+			return
+		}
+		ctx.Error = jas.NewRequestError("Bad publish request: " + err.Error())
+		return
+	}
+	file, _, err := ctx.FormFile("axe")
+	if err != nil {
+		ctx.Error = jas.NewRequestError("Bad publish request: " + err.Error())
+		return
+	}
+	defer file.Close()
+
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		ctx.Error = jas.NewRequestError("Bad publish request: " + err.Error())
+		return
+	}
+	if len(data) > maxAxeSize {
+		axeTooLarge(ctx)
+		return
+	}
+
+	dryRun := ctx.FormValue("dryRun") == "true"
+	ctx.Data = this.publish(publisher, data, ctx.FormValue("signature"), dryRun)
+}
+
+func (this *Axes) publish(publisher *common.Publisher, data []byte, signature string, dryRun bool) *common.PublishResult {
+	result := new(common.PublishResult)
+	result.Status = "rejected"
+
+	if signature == "" && this.config.RequireSignatures {
+		result.Reason = "Axe is not signed."
+		return result
+	}
+	if signature != "" && !verifySignature(publisher, data, signature) {
+		result.Reason = "Bad signature, or not signed with a trusted key of publisher " + publisher.Name + "."
+		return result
+	}
+
+	z, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		result.Reason = "Cannot open axe archive: " + err.Error()
+		return result
+	}
+
+	metadata, err := common.ReadPackageMetadata(z)
+	if err != nil {
+		result.Reason = err.Error()
+		return result
+	}
+	result.PluginName = metadata.PluginName
+	result.Version = metadata.Version
+
+	if problems := common.Axe_v2check(metadata); len(problems) != 0 {
+		result.Reason = "Bad or incomplete metadata."
+		result.Problems = problems
+		return result
+	}
+
+	count, err := this.catalog.CountByNameVersion(metadata.PluginName, metadata.Version)
+	if err != nil {
+		log.Printf("Error: Relaxe database error. %v\n", err.Error())
+		result.Reason = "Relaxe database error."
+		return result
+	}
+	if count != 0 { //if Relaxe already has axes of the same pluginName and version
+		result.Status = "skipped"
+		result.Reason = "Axe is already published."
+		return result
+	}
+	if dryRun {
+		result.Status = "accepted"
+		return result
+	}
+
+	u, err := uuid.NewV4()
+	if err != nil {
+		result.Reason = "Cannot generate AxeId."
+		return result
+	}
+	// Fields only Relaxe sets, whatever the uploaded metadata says
+	metadata.AxeId = u.String()
+	metadata.Downloads = nil
+	metadata.Yanked = false
+	metadata.Publisher = publisher.Name
+	metadata.Signature = signature
+	metadata.Sha256 = fmt.Sprintf("%x", sha256.Sum256(data))
+
+	axeFilePath, err := cache.Store(this.config.CacheDirectory, metadata, data)
+	if err != nil {
+		log.Printf("Error: cannot store axe %v-%v. %v\n", metadata.PluginName, metadata.Version, err.Error())
+		result.Reason = "Cannot store axe."
+		return result
+	}
+
+	if err = this.catalog.Insert(metadata); err == catalog.ErrDuplicate { //published concurrently since we counted
+		cache.Remove(this.config.CacheDirectory, metadata)
+		result.Status = "skipped"
+		result.Reason = "Axe is already published."
+		return result
+	} else if err != nil {
+		log.Printf("Error: cannot insert axe %v-%v. %v\n", metadata.PluginName, metadata.Version, err.Error())
+		cache.Remove(this.config.CacheDirectory, metadata)
+		result.Reason = "Relaxe database error."
+		return result
+	}
+
+	log.Printf("* %v published %v-%v as %v.\n", publisher.Name, metadata.PluginName, metadata.Version, axeFilePath)
+	result.Status = "published"
+	result.AxeId = metadata.AxeId
+	return result
+}
@@ -0,0 +1,121 @@
+/* === This file is part of Relaxe - <https://github.com/teo/relaxe> ===
+ *
+ *   Copyright 2013, Teo Mrnjavac <teo@kde.org>
+ *
+ *   Relaxe is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   Relaxe is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with Relaxe. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"bytes"
+	"github.com/coocood/jas"
+	"github.com/teo/relaxe/common"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// postContext returns the context of a publish request for an axe file.
+func postContext(t *testing.T, token string, data []byte) *jas.Context {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	part, err := w.CreateFormFile("axe", "foo.axe")
+	if err == nil {
+		_, err = part.Write(data)
+	}
+	if err == nil {
+		err = w.Close()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest("POST", "/axes", &body)
+	r.Header.Set("Content-Type", w.FormDataContentType())
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	return &jas.Context{Request: r, ResponseWriter: httptest.NewRecorder(), ResponseHeader: http.Header{}}
+}
+
+func TestPost(t *testing.T) {
+	axes := newTestAxes(t)
+	axes.config.Publishers = []common.Publisher{{Name: "tester", Token: "secret"}}
+
+	tests := []struct {
+		name   string
+		data   []byte
+		status int //of the error, 0 for none
+	}{
+		{"axe", axeArchive(t, testMetadata("foo", "1.0.0")), 0},
+		{"over the axe size", make([]byte, maxAxeSize+1), http.StatusRequestEntityTooLarge},
+		{"over the request size", make([]byte, maxAxeSize+maxFormOverhead), http.StatusRequestEntityTooLarge},
+	}
+	for _, test := range tests {
+		ctx := postContext(t, "secret", test.data)
+		axes.Post(ctx)
+		if got := errorStatus(ctx); got != test.status {
+			t.Errorf("%v: Post() error %v, want status %v", test.name, ctx.Error, test.status)
+		} else if test.status == 0 && ctx.Data.(*common.PublishResult).Status != "published" {
+			t.Errorf("%v: Post() = %+v, want published", test.name, ctx.Data)
+		}
+	}
+}
+
+func TestAuthorization(t *testing.T) {
+	axes := newTestAxes(t)
+	axes.config.Publishers = []common.Publisher{
+		{Name: "tester", Token: "secret"},
+		{Name: "admin", Token: "root", Admin: true},
+	}
+	admin := NewAdmin(axes)
+	data := axeArchive(t, testMetadata("foo", "1.0.0"))
+
+	tests := []struct {
+		token       string
+		postStatus  int //of the error, 0 for none
+		adminStatus int
+	}{
+		{"", http.StatusUnauthorized, http.StatusUnauthorized},
+		{"wrong", http.StatusUnauthorized, http.StatusUnauthorized},
+		{"secret", 0, http.StatusForbidden},
+		{"root", 0, 0},
+	}
+	for _, test := range tests {
+		ctx := postContext(t, test.token, data)
+		axes.Post(ctx)
+		if got := errorStatus(ctx); got != test.postStatus {
+			t.Errorf("token %q: Post() status %v, want %v", test.token, got, test.postStatus)
+		}
+		if test.postStatus == http.StatusUnauthorized && ctx.ResponseHeader.Get("WWW-Authenticate") == "" {
+			t.Errorf("token %q: Post() without WWW-Authenticate", test.token)
+		}
+
+		ctx = postContext(t, test.token, nil)
+		admin.authorize(ctx)
+		if got := errorStatus(ctx); got != test.adminStatus {
+			t.Errorf("token %q: authorize() status %v, want %v", test.token, got, test.adminStatus)
+		}
+	}
+}
+
+// errorStatus returns the HTTP status of the error set on ctx, 0 if there is none.
+func errorStatus(ctx *jas.Context) int {
+	if ctx.Error == nil {
+		return 0
+	}
+	return ctx.Error.Status()
+}
@@ -31,6 +31,7 @@ import (
 	"path"
 	"path/filepath"
 	"syscall"
+	"time"
 )
 
 const (
@@ -68,10 +69,13 @@ func init() {
 	flag.Usage = usage
 }
 
-func sigintCatcher() {
-	ch := make(chan os.Signal)
-	signal.Notify(ch, syscall.SIGINT)
+// signalCatcher runs cleanup and exits on SIGINT, or on the SIGTERM sent by
+// service managers (e.g. systemd, docker stop), so that no downloads are lost.
+func signalCatcher(cleanup func()) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
 	<-ch
+	cleanup()
 	os.Exit(0)
 }
 
@@ -112,8 +116,6 @@ func main() {
 		die("Bad Relaxe configuration file path: " + configFilePath)
 	}
 
-	go sigintCatcher()
-
 	config, err := common.LoadConfig(configFilePath)
 	if err != nil {
 		fmt.Println(err.Error())
@@ -125,14 +127,23 @@ func main() {
 	if err != nil {
 		die("Error: cannot start Relaxe server. Reason: " + err.Error())
 	}
+	go signalCatcher(axes.Close)
+
+	if config.Scrubber.Interval != "" {
+		interval, err := time.ParseDuration(config.Scrubber.Interval)
+		if err != nil || interval <= 0 {
+			die("Error: bad scrubber interval " + config.Scrubber.Interval + ".")
+		}
+		go axes.scrubLoop(interval)
+	}
 
-	router := jas.NewRouter(axes)
+	router := jas.NewRouter(axes, NewAdmin(axes))
 	router.RequestErrorLogger = router.InternalErrorLogger
 	router.BasePath = "/v1/"
 
 	// FileServer for the axes cache
 	fileserver := http.StripPrefix(config.Server.CachePath,
-		http.FileServer(http.Dir(config.CacheDirectory)))
+		immutableFiles(http.FileServer(http.Dir(config.CacheDirectory))))
 
 	hostString := fmt.Sprintf("%v:%v", config.Server.Host, config.Server.Port)
 
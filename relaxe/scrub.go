@@ -0,0 +1,72 @@
+/* === This file is part of Relaxe - <https://github.com/teo/relaxe> ===
+ *
+ *   Copyright 2013, Teo Mrnjavac <teo@kde.org>
+ *
+ *   Relaxe is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   Relaxe is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with Relaxe. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"github.com/teo/relaxe/common/cache"
+	"log"
+	"time"
+)
+
+// Scrub checks the cache directory against the catalog, and hides the axes
+// whose files are missing or corrupt until the next scrub finds them fixed.
+func (this *Axes) Scrub(deleteOrphans bool) (*cache.ScrubReport, error) {
+	axes, err := this.catalog.FindAll()
+	if err != nil {
+		return nil, err
+	}
+	report, err := cache.Scrub(this.config.CacheDirectory, axes, deleteOrphans)
+	if err != nil {
+		return report, err
+	}
+
+	hidden := map[string]bool{}
+	for _, p := range report.Problems {
+		log.Printf("Warning: hiding axe %v-%v (%v). %v\n", p.PluginName, p.Version, p.AxeId, p.Problem)
+		hidden[p.AxeId] = true
+	}
+	for _, name := range report.Orphans {
+		log.Printf("Warning: orphaned file %v in cache directory.\n", name)
+	}
+	if len(report.Deleted) != 0 {
+		log.Printf("* Deleted %v orphaned files from cache directory.\n", len(report.Deleted))
+	}
+
+	this.hiddenMutex.Lock()
+	this.hidden = hidden
+	this.hiddenMutex.Unlock()
+	this.responses.clear() //they may list axes that are now hidden, or the other way around
+	return report, nil
+}
+
+func (this *Axes) isHidden(axeId string) bool {
+	this.hiddenMutex.RLock()
+	defer this.hiddenMutex.RUnlock()
+	return this.hidden[axeId]
+}
+
+// scrubLoop scrubs the cache directory right away, and then every interval.
+func (this *Axes) scrubLoop(interval time.Duration) {
+	for {
+		if _, err := this.Scrub(this.config.Scrubber.DeleteOrphans); err != nil {
+			log.Println("Error: cannot scrub cache directory. " + err.Error())
+		}
+		time.Sleep(interval)
+	}
+}
@@ -0,0 +1,374 @@
+/* === This file is part of Relaxe - <https://github.com/teo/relaxe> ===
+ *
+ *   Copyright 2013, Teo Mrnjavac <teo@kde.org>
+ *
+ *   Relaxe is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   Relaxe is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with Relaxe. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/teo/relaxe/common"
+	"github.com/teo/relaxe/common/cache"
+	"github.com/teo/relaxe/common/catalog"
+	"github.com/teo/relaxe/common/counter"
+	"github.com/teo/relaxe/common/util"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	programName        = "relaxectl"
+	programDescription = "the Relaxe administration tool"
+	programVersion     = "0.1"
+)
+
+var (
+	help           bool
+	configFilePath string
+)
+
+func usage() {
+	fmt.Printf("*** %v %v - %v ***\n\n", programName, programVersion, programDescription)
+	fmt.Println("Usage: ./relaxectl [OPTIONS] COMMAND [ARGUMENTS]")
+	fmt.Println("OPTIONS")
+	flag.VisitAll(func(f *flag.Flag) {
+		if len(f.Name) < 2 {
+			return
+		}
+		fmt.Printf("\t%v\n", f.Usage)
+	})
+	fmt.Println("COMMANDS")
+	fmt.Println("\tlist\t\t\tlist all plugins with their newest version, number of versions and download count")
+	fmt.Println("\tlist PLUGIN\t\tlist all the versions of a plugin")
+	fmt.Println("\tshow PLUGIN VERSION\tprint the full metadata of a version")
+	fmt.Println("\tset-downloads PLUGIN COUNT\tset the download count of a plugin")
+	fmt.Println("\treset-downloads PLUGIN\tset the download count of a plugin to 0")
+	fmt.Println("\tdelete PLUGIN VERSION\tremove a version from the catalog and its files from the cache directory")
+	fmt.Println("\tdu\t\t\treport the disk usage of the cache directory")
+}
+
+func die(message string) {
+	fmt.Println(message)
+	fmt.Println("See ./relaxectl --help for usage information.")
+	os.Exit(2)
+}
+
+func init() {
+	const (
+		flagHelpUsage   = "--help, -h\tthis help message"
+		flagConfigUsage = "--config, -c CONFIG\tthe path of the Relaxe configuration file, defaults to \"./relaxe.json\""
+	)
+	flag.BoolVar(&help, "help", false, flagHelpUsage)
+	flag.BoolVar(&help, "h", false, flagHelpUsage)
+	flag.StringVar(&configFilePath, "config", "relaxe.json", flagConfigUsage)
+	flag.StringVar(&configFilePath, "c", "relaxe.json", flagConfigUsage)
+
+	flag.Usage = usage
+}
+
+// checkArgs dies unless the command got between min and max arguments.
+func checkArgs(args []string, min int, max int) {
+	if len(args) < min || len(args) > max {
+		die("Error: wrong number of arguments for " + flag.Arg(0) + ".")
+	}
+}
+
+func main() {
+	flag.Parse()
+
+	if help {
+		usage()
+		return
+	}
+	if len(flag.Args()) == 0 {
+		die("Error: a command must be specified.")
+	}
+
+	path, err := filepath.Abs(configFilePath)
+	if err != nil {
+		die("Error: bad Relaxe configuration file path.")
+	}
+	if ex, err := util.ExistsFile(path); !ex || err != nil {
+		die("Bad Relaxe configuration file path: " + path)
+	}
+	config, err := common.LoadConfig(path)
+	if err != nil {
+		fmt.Println(err.Error())
+		die("Cannot load config file.")
+	}
+
+	c, err := catalog.Open(config)
+	if err != nil {
+		die("Error: cannot connect to Relaxe database. Reason: " + err.Error())
+	}
+	defer c.Close()
+
+	command, args := flag.Arg(0), flag.Args()[1:]
+	switch command {
+	case "list":
+		checkArgs(args, 0, 1)
+		if len(args) == 0 {
+			err = listPlugins(c, openCounter(config))
+		} else {
+			err = listVersions(c, args[0])
+		}
+	case "show":
+		checkArgs(args, 2, 2)
+		err = show(c, args[0], args[1])
+	case "set-downloads":
+		checkArgs(args, 2, 2)
+		count, parseErr := strconv.ParseInt(args[1], 10, 64)
+		if parseErr != nil || count < 0 {
+			die("Error: bad download count " + args[1] + ".")
+		}
+		err = setDownloads(openCounter(config), args[0], count)
+	case "reset-downloads":
+		checkArgs(args, 1, 1)
+		err = setDownloads(openCounter(config), args[0], 0)
+	case "delete":
+		checkArgs(args, 2, 2)
+		err = deleteVersion(c, config.CacheDirectory, args[0], args[1])
+	case "du":
+		checkArgs(args, 0, 0)
+		err = diskUsage(c, config.CacheDirectory)
+	default:
+		die("Error: unknown command " + command + ".")
+	}
+
+	if err != nil {
+		fmt.Println("Error: " + err.Error())
+		os.Exit(1)
+	}
+}
+
+func openCounter(config *common.RelaxeConfig) counter.Counter {
+	dlCounter, err := counter.Open(config)
+	if err != nil {
+		die("Error: cannot connect to Relaxe kvStore. Reason: " + err.Error())
+	}
+	return dlCounter
+}
+
+// byPlugin groups axes by pluginName, each group sorted newest version first.
+func byPlugin(axes []common.Axe_v2) map[string][]common.Axe_v2 {
+	plugins := map[string][]common.Axe_v2{}
+	for _, axe := range axes {
+		plugins[axe.PluginName] = append(plugins[axe.PluginName], axe)
+	}
+	for _, versions := range plugins {
+		sort.SliceStable(versions, func(i, j int) bool {
+			return util.VersionCompare(versions[i].Version, versions[j].Version) > 0
+		})
+	}
+	return plugins
+}
+
+func sortedKeys(plugins map[string][]common.Axe_v2) []string {
+	names := []string{}
+	for name := range plugins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func listPlugins(c catalog.Catalog, dlCounter counter.Counter) error {
+	defer dlCounter.Close()
+
+	axes, err := c.FindAll()
+	if err != nil {
+		return err
+	}
+	plugins := byPlugin(axes)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "PLUGIN\tNEWEST\tVERSIONS\tDOWNLOADS")
+	for _, name := range sortedKeys(plugins) {
+		dlcount, err := dlCounter.Get(name)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", name, plugins[name][0].Version, len(plugins[name]), dlcount)
+	}
+	return w.Flush()
+}
+
+func listVersions(c catalog.Catalog, pluginName string) error {
+	axes, err := c.FindByPluginName(pluginName)
+	if err != nil {
+		return err
+	}
+	versions := byPlugin(axes)[pluginName]
+	if len(versions) == 0 {
+		return catalog.ErrNotFound
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tCHANNEL\tPLATFORM\tAPI\tPUBLISHED\tPUBLISHER\tAXEID\tYANKED")
+	for _, axe := range versions {
+		channel := axe.Channel
+		if channel == "" {
+			channel = common.Channels[0]
+		}
+		published := "-"
+		if axe.Timestamp != nil {
+			published = time.Unix(*axe.Timestamp, 0).UTC().Format("2006-01-02 15:04")
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\n", axe.Version, channel, strings.Join(axe.PlatformList(), ","), axe.ApiVersion,
+			published, axe.Publisher, axe.AxeId, axe.Yanked)
+	}
+	return w.Flush()
+}
+
+// findVersion returns the catalog entries for one version of a plugin.
+func findVersion(c catalog.Catalog, pluginName string, version string) ([]common.Axe_v2, error) {
+	axes, err := c.FindByPluginName(pluginName)
+	if err != nil {
+		return nil, err
+	}
+	result := []common.Axe_v2{}
+	for _, axe := range axes {
+		if axe.Version == version {
+			result = append(result, axe)
+		}
+	}
+	if len(result) == 0 {
+		return nil, catalog.ErrNotFound
+	}
+	return result, nil
+}
+
+func show(c catalog.Catalog, pluginName string, version string) error {
+	axes, err := findVersion(c, pluginName, version)
+	if err != nil {
+		return err
+	}
+	for _, axe := range axes {
+		data, err := json.MarshalIndent(axe, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	}
+	return nil
+}
+
+func setDownloads(dlCounter counter.Counter, pluginName string, count int64) error {
+	defer dlCounter.Close()
+
+	if err := dlCounter.Set(pluginName, count); err != nil {
+		return err
+	}
+	fmt.Printf("Download count for %v set to %v.\n", pluginName, count)
+	return nil
+}
+
+func deleteVersion(c catalog.Catalog, cacheDir string, pluginName string, version string) error {
+	deleted, err := c.Delete(pluginName, version)
+	if err != nil {
+		return err
+	}
+	for i := range deleted {
+		if err := cache.Remove(cacheDir, &deleted[i]); err != nil {
+			fmt.Printf("Warning: cannot remove files of axe %v. %v\n", cache.AxeFileName(&deleted[i]), err.Error())
+		}
+		fmt.Printf("Deleted %v-%v (%v).\n", pluginName, version, deleted[i].AxeId)
+	}
+	return nil
+}
+
+func formatSize(size int64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	value := float64(size)
+	i := 0
+	for value >= 1024 && i < len(units)-1 {
+		value /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%v %v", size, units[0])
+	}
+	return fmt.Sprintf("%.1f %v", value, units[i])
+}
+
+// diskUsage reports the size of the cache directory, per plugin for the axes
+// in the catalog, and for the files that don't belong to any of them.
+func diskUsage(c catalog.Catalog, cacheDir string) error {
+	entries, err := ioutil.ReadDir(cacheDir)
+	if err != nil {
+		return err
+	}
+	axes, err := c.FindAll()
+	if err != nil {
+		return err
+	}
+
+	owner := map[string]string{} //file name => pluginName
+	for i := range axes {
+		for _, fileName := range []string{cache.AxeFileName(&axes[i]), cache.SumFileName(&axes[i]), cache.SigFileName(&axes[i])} {
+			owner[fileName] = axes[i].PluginName
+		}
+	}
+
+	sizes := map[string]int64{}
+	counts := map[string]int{}
+	var total, other int64
+	otherCount := 0
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		total += entry.Size()
+		if pluginName, ok := owner[entry.Name()]; ok {
+			sizes[pluginName] += entry.Size()
+			if strings.HasSuffix(entry.Name(), ".axe") {
+				counts[pluginName]++
+			}
+		} else {
+			other += entry.Size()
+			otherCount++
+		}
+	}
+
+	names := []string{}
+	for name := range sizes {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if sizes[names[i]] != sizes[names[j]] {
+			return sizes[names[i]] > sizes[names[j]]
+		}
+		return names[i] < names[j]
+	})
+
+	fmt.Printf("Cache directory: %v\n", cacheDir)
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "PLUGIN\tAXES\tSIZE")
+	for _, name := range names {
+		fmt.Fprintf(w, "%v\t%v\t%v\n", name, counts[name], formatSize(sizes[name]))
+	}
+	fmt.Fprintf(w, "(other files)\t%v\t%v\n", otherCount, formatSize(other))
+	fmt.Fprintf(w, "Total\t\t%v\n", formatSize(total))
+	return w.Flush()
+}